@@ -0,0 +1,151 @@
+package simwatchproviders
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Cache keeps the last good raw payloads so providers can boot
+// when their sources are unreachable. Nil cache is a valid no-op cache.
+type Cache struct {
+	dir string
+}
+
+// NewCache returns nil if dir is empty
+func NewCache(dir string) *Cache {
+	if dir == "" {
+		return nil
+	}
+	return &Cache{dir: dir}
+}
+
+func (c *Cache) filename(name string) string {
+	return filepath.Join(c.dir, name)
+}
+
+// Save atomically replaces the cached payload
+func (c *Cache) Save(name string, data []byte) error {
+	if c == nil {
+		return nil
+	}
+	err := os.MkdirAll(c.dir, 0755)
+	if err != nil {
+		return err
+	}
+	tmpFilename := c.filename(name) + ".tmp"
+	err = os.WriteFile(tmpFilename, data, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpFilename, c.filename(name))
+}
+
+// Load returns the cached payload and the time it has been saved at
+func (c *Cache) Load(name string) ([]byte, time.Time, error) {
+	if c == nil {
+		return nil, time.Time{}, fmt.Errorf("cache is not configured")
+	}
+	st, err := os.Stat(c.filename(name))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	data, err := os.ReadFile(c.filename(name))
+	return data, st.ModTime(), err
+}
+
+// CacheTracker saves fresh payloads of a provider to the cache and
+// tracks which of them have been loaded from it on boot
+type CacheTracker struct {
+	cache *Cache
+	stale map[string]bool
+
+	lock sync.Mutex
+}
+
+func NewCacheTracker() *CacheTracker {
+	return &CacheTracker{stale: make(map[string]bool)}
+}
+
+// SetCache sets the cache, nil cache disables saving payloads
+func (ct *CacheTracker) SetCache(cache *Cache) {
+	ct.lock.Lock()
+	defer ct.lock.Unlock()
+	ct.cache = cache
+}
+
+// Cache returns the cache to boot from
+func (ct *CacheTracker) Cache() *Cache {
+	ct.lock.Lock()
+	defer ct.lock.Unlock()
+	return ct.cache
+}
+
+// Parsed saves a fresh payload to the cache or marks
+// the data as stale if the payload has been loaded from the cache
+func (ct *CacheTracker) Parsed(name string, data []byte, stale bool) {
+	ct.lock.Lock()
+	if stale {
+		ct.stale[name] = true
+	} else {
+		delete(ct.stale, name)
+	}
+	cache := ct.cache
+	ct.lock.Unlock()
+
+	if stale {
+		return
+	}
+	if err := cache.Save(name, data); err != nil {
+		log.WithError(err).WithField("name", name).Error("error saving payload to cache")
+	}
+}
+
+// IsStale returns true if any payload has been loaded from the cache
+// and hasn't been refreshed from its source yet
+func (ct *CacheTracker) IsStale() bool {
+	ct.lock.Lock()
+	defer ct.lock.Unlock()
+	return len(ct.stale) > 0
+}
+
+// Boot fetches the initial payload making up to cfg.Retries attempts.
+// If all of them fail, the payload is loaded from the cache and
+// returned with the stale flag set. Cancelling ctx aborts the boot.
+func Boot(ctx context.Context, name string, fetch Fetcher, cfg BootConfig, cache *Cache) ([]byte, bool, error) {
+	blog := log.WithField("source", name)
+	retries := cfg.Retries
+	if retries < 1 {
+		retries = 1
+	}
+
+	var err error
+	for r := 1; r <= retries; r++ {
+		var data []byte
+		data, err = fetch()
+		if err == nil && data != nil {
+			return data, false, nil
+		}
+		if err == nil {
+			err = fmt.Errorf("empty payload")
+		}
+		blog.WithError(err).WithField("retries_left", retries-r).Error("error fetching initial payload")
+		if r < retries {
+			select {
+			case <-time.After(cfg.RetryCooldown):
+			case <-ctx.Done():
+				return nil, false, ctx.Err()
+			}
+		}
+	}
+
+	data, savedAt, cerr := cache.Load(name)
+	if cerr != nil {
+		return nil, false, fmt.Errorf("no retries left: %v, can't load cache: %v", err, cerr)
+	}
+	blog.WithField("saved_at", savedAt).Warn("no retries left, booting from cache, data is stale")
+	return data, true, nil
+}
@@ -0,0 +1,76 @@
+package simwatchproviders
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestBootFromCache(t *testing.T) {
+	cache := NewCache(t.TempDir())
+	cfg := BootConfig{Retries: 2}
+	payload := []byte("payload")
+
+	failing := func() ([]byte, error) { return nil, fmt.Errorf("unreachable") }
+	working := func() ([]byte, error) { return payload, nil }
+
+	if _, _, err := Boot(context.Background(), "test", failing, cfg, cache); err == nil {
+		t.Error("expected error with empty cache")
+	}
+
+	data, stale, err := Boot(context.Background(), "test", working, cfg, cache)
+	if err != nil || stale || !bytes.Equal(data, payload) {
+		t.Fatalf("expected fresh payload, got %s, stale=%v (%v)", data, stale, err)
+	}
+	if err := cache.Save("test", data); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, stale, err = Boot(context.Background(), "test", failing, cfg, cache)
+	if err != nil || !stale || !bytes.Equal(data, payload) {
+		t.Errorf("expected stale payload from cache, got %s, stale=%v (%v)", data, stale, err)
+	}
+
+	if _, _, err := Boot(context.Background(), "test", failing, cfg, nil); err == nil {
+		t.Error("expected error with no cache configured")
+	}
+}
+
+func TestCacheTracker(t *testing.T) {
+	cache := NewCache(t.TempDir())
+	ct := NewCacheTracker()
+	ct.SetCache(cache)
+
+	testcases := []struct {
+		name   string
+		data   string
+		stale  bool
+		cached string
+		exp    bool
+	}{
+		{"a", "a1", false, "a1", false},
+		{"b", "b0", true, "", true},
+		{"a", "a0", true, "a1", true},
+		{"b", "b1", false, "b1", true},
+		{"a", "a2", false, "a2", false},
+	}
+
+	for i, tc := range testcases {
+		ct.Parsed(tc.name, []byte(tc.data), tc.stale)
+		if ct.IsStale() != tc.exp {
+			t.Errorf("step %d: expected stale to be %v", i, tc.exp)
+		}
+		data, _, _ := cache.Load(tc.name)
+		if string(data) != tc.cached {
+			t.Errorf("step %d: expected '%s' cached as %s, got '%s'", i, tc.cached, tc.name, data)
+		}
+	}
+
+	// nil cache is a no-op
+	ct.SetCache(nil)
+	ct.Parsed("a", []byte("a3"), false)
+	if data, _, _ := cache.Load("a"); string(data) != "a2" {
+		t.Errorf("expected cache not to be used, got '%s'", data)
+	}
+}
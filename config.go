@@ -5,6 +5,9 @@ import "time"
 type BootConfig struct {
 	Retries       int           `mapstructure:"retries,omitempty"`
 	RetryCooldown time.Duration `mapstructure:"retry_cooldown,omitempty"`
+	// CacheDir keeps the last good payloads to boot from
+	// when the sources are unreachable
+	CacheDir string `mapstructure:"cache_dir,omitempty"`
 }
 
 type PollConfig struct {
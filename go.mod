@@ -3,6 +3,7 @@ module github.com/vatsimnerd/simwatch-providers
 go 1.18
 
 require (
+	github.com/klauspost/compress v1.15.15
 	github.com/paulmach/orb v0.7.1
 	github.com/sirupsen/logrus v1.8.1
 	github.com/vatsimnerd/perfetch v0.9.3
@@ -0,0 +1,133 @@
+package simwatchproviders
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/vatsimnerd/perfetch"
+)
+
+// Loop is a provider loop. It must report the initial boot result
+// to booted exactly once and return when ctx is done.
+type Loop func(ctx context.Context, booted chan<- error)
+
+// Lifecycle runs a provider loop bound to a context
+type Lifecycle struct {
+	cancel     context.CancelFunc
+	done       chan struct{}
+	started    bool
+	stopped    bool
+	booted     bool
+	bootFailed bool
+
+	lock sync.Mutex
+}
+
+var (
+	ErrStopped = errors.New("can't start once stopped provider")
+	ErrStarted = errors.New("provider is already started")
+)
+
+func NewLifecycle() *Lifecycle {
+	return &Lifecycle{done: make(chan struct{})}
+}
+
+// Start runs the loop with a context which is cancelled either when ctx
+// is done or on Stop. It blocks until the loop is booted or ctx is done.
+func (l *Lifecycle) Start(ctx context.Context, loop Loop) error {
+	l.lock.Lock()
+	if l.stopped {
+		l.lock.Unlock()
+		return ErrStopped
+	}
+	if l.started {
+		l.lock.Unlock()
+		return ErrStarted
+	}
+	l.started = true
+	ctx, l.cancel = context.WithCancel(ctx)
+	l.lock.Unlock()
+
+	booted := make(chan error, 1)
+	go func() {
+		defer close(l.done)
+		defer l.cancel()
+		loop(ctx, booted)
+	}()
+
+	select {
+	case err := <-booted:
+		l.setBooted(err)
+		return err
+	case <-ctx.Done():
+		// a loop failing to boot reports the error right before
+		// returning which cancels ctx as well
+		select {
+		case err := <-booted:
+			l.setBooted(err)
+			return err
+		default:
+			return ctx.Err()
+		}
+	}
+}
+
+func (l *Lifecycle) setBooted(err error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.booted = err == nil
+	l.bootFailed = err != nil
+}
+
+// State returns the loop state. A loop which has failed to boot
+// but keeps running is reported as degraded.
+func (l *Lifecycle) State() State {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if !l.started || l.stopped {
+		return StateStopped
+	}
+	select {
+	case <-l.done:
+		return StateStopped
+	default:
+	}
+	switch {
+	case l.bootFailed:
+		return StateDegraded
+	case !l.booted:
+		return StateBooting
+	}
+	return StateReady
+}
+
+// Stop cancels the loop and waits for it to return. It's safe to call
+// Stop multiple times and on a provider which has never been started.
+func (l *Lifecycle) Stop() {
+	l.lock.Lock()
+	if !l.stopped {
+		l.stopped = true
+		if l.started {
+			l.cancel()
+		} else {
+			close(l.done)
+		}
+	}
+	l.lock.Unlock()
+	<-l.done
+}
+
+// Done returns a channel which is closed once the loop has returned
+func (l *Lifecycle) Done() <-chan struct{} {
+	return l.done
+}
+
+// StopPoller stops a started poller and waits until it closes the
+// subscription. Pending payloads are discarded so the poller never
+// blocks on a full subscription channel.
+func StopPoller[T any](poller *perfetch.Server[T], sub perfetch.Subscription[T]) {
+	go poller.Stop()
+	for range sub.Updates() {
+	}
+}
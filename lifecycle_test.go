@@ -0,0 +1,61 @@
+package simwatchproviders
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLifecycle(t *testing.T) {
+	l := NewLifecycle()
+	loop := func(ctx context.Context, booted chan<- error) {
+		booted <- nil
+		<-ctx.Done()
+	}
+	if err := l.Start(context.Background(), loop); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := l.Start(context.Background(), loop); err != ErrStarted {
+		t.Errorf("expected %v, got %v", ErrStarted, err)
+	}
+
+	l.Stop()
+	l.Stop()
+	select {
+	case <-l.Done():
+	default:
+		t.Error("lifecycle is expected to be done after stop")
+	}
+	if err := l.Start(context.Background(), loop); err != ErrStopped {
+		t.Errorf("expected %v, got %v", ErrStopped, err)
+	}
+}
+
+func TestLifecycleBootError(t *testing.T) {
+	l := NewLifecycle()
+	bootErr := errors.New("boot failed")
+	err := l.Start(context.Background(), func(ctx context.Context, booted chan<- error) {
+		booted <- bootErr
+	})
+	if err != bootErr {
+		t.Errorf("expected %v, got %v", bootErr, err)
+	}
+	<-l.Done()
+	l.Stop()
+}
+
+func TestLifecycleContext(t *testing.T) {
+	l := NewLifecycle()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := l.Start(ctx, func(ctx context.Context, booted chan<- error) {
+		// never boots
+		<-ctx.Done()
+	})
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	// the loop is bound to ctx and stops by itself
+	<-l.Done()
+}
@@ -0,0 +1,210 @@
+package merged
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+type (
+	AliasMatch string
+
+	// Alias maps callsigns matching Pattern to an airport, a FIR or a UIR.
+	// Only one of Airport, FIR and UIR is expected to be set.
+	Alias struct {
+		Match   AliasMatch `json:"match"`
+		Pattern string     `json:"pattern"`
+		Airport string     `json:"airport,omitempty"`
+		FIR     string     `json:"fir,omitempty"`
+		UIR     string     `json:"uir,omitempty"`
+
+		re *regexp.Regexp
+	}
+
+	aliasTable struct {
+		exact    map[string]*Alias
+		prefixes []*Alias
+		regexps  []*Alias
+	}
+
+	// Resolution explains how a callsign is resolved to a lookup key
+	Resolution struct {
+		Callsign string   `json:"callsign"`
+		Key      string   `json:"key"`
+		Alias    *Alias   `json:"alias,omitempty"`
+		Airport  string   `json:"airport,omitempty"`
+		FIRs     []string `json:"firs,omitempty"`
+		Steps    []string `json:"steps"`
+	}
+)
+
+const (
+	AliasMatchExact  AliasMatch = "exact"
+	AliasMatchPrefix AliasMatch = "prefix"
+	AliasMatchRegex  AliasMatch = "regex"
+)
+
+func newAliasTable(aliases []Alias) (*aliasTable, error) {
+	t := &aliasTable{exact: make(map[string]*Alias)}
+	for i := range aliases {
+		a := aliases[i]
+		if a.key() == "" {
+			return nil, fmt.Errorf("alias '%s' has no airport, fir or uir", a.Pattern)
+		}
+		switch a.Match {
+		case AliasMatchExact:
+			t.exact[a.Pattern] = &a
+		case AliasMatchPrefix:
+			t.prefixes = append(t.prefixes, &a)
+		case AliasMatchRegex:
+			re, err := regexp.Compile(a.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid alias regex '%s': %v", a.Pattern, err)
+			}
+			a.re = re
+			t.regexps = append(t.regexps, &a)
+		default:
+			return nil, fmt.Errorf("invalid alias match type '%s'", a.Match)
+		}
+	}
+	return t, nil
+}
+
+func loadAliasTable(filename string) (*aliasTable, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	aliases := make([]Alias, 0)
+	err = json.Unmarshal(data, &aliases)
+	if err != nil {
+		return nil, err
+	}
+	return newAliasTable(aliases)
+}
+
+func (a Alias) key() string {
+	switch {
+	case a.Airport != "":
+		return a.Airport
+	case a.FIR != "":
+		return a.FIR
+	}
+	return a.UIR
+}
+
+// find returns the matching alias: exact match first,
+// then the longest prefix, then regexps in file order
+func (t *aliasTable) find(callsign string) *Alias {
+	if t == nil {
+		return nil
+	}
+	if a, found := t.exact[callsign]; found {
+		return a
+	}
+	var res *Alias
+	for _, a := range t.prefixes {
+		if strings.HasPrefix(callsign, a.Pattern) && (res == nil || len(a.Pattern) > len(res.Pattern)) {
+			res = a
+		}
+	}
+	if res != nil {
+		return res
+	}
+	for _, a := range t.regexps {
+		if a.re.MatchString(callsign) {
+			return a
+		}
+	}
+	return nil
+}
+
+// resolveCallsignUnsafe returns the key used to look up airports, FIRs and UIRs
+func (p *Provider) resolveCallsignUnsafe(callsign string) (string, *Alias) {
+	if a := p.aliases.find(callsign); a != nil {
+		return a.key(), a
+	}
+	tokens := strings.Split(callsign, "_")
+	return tokens[0], nil
+}
+
+// ReloadAliases re-reads the aliases file. The previous table is kept on error.
+// Controllers already online are re-resolved with the new table.
+func (p *Provider) ReloadAliases() error {
+	if p.cfg == nil || p.cfg.AliasesFile == "" {
+		return nil
+	}
+	table, err := loadAliasTable(p.cfg.AliasesFile)
+	if err != nil {
+		return err
+	}
+	p.dataLock.Lock()
+	defer p.dataLock.Unlock()
+	p.aliases = table
+
+	// the feed only republishes controllers which have changed
+	callsigns := make([]string, 0, len(p.controllers))
+	for callsign := range p.controllers {
+		callsigns = append(callsigns, callsign)
+	}
+	sort.Strings(callsigns)
+	for _, callsign := range callsigns {
+		if ctrl, found := p.controllers[callsign]; found {
+			p.setControllerUnsafe(ctrl.Controller)
+		}
+	}
+	return nil
+}
+
+// watchAliases reloads aliases file when its modification time changes
+func (p *Provider) watchAliases(lastMod time.Time) time.Time {
+	st, err := os.Stat(p.cfg.AliasesFile)
+	if err != nil {
+		log.WithError(err).WithField("filename", p.cfg.AliasesFile).Error("error checking aliases file")
+		return lastMod
+	}
+	if !st.ModTime().After(lastMod) {
+		return lastMod
+	}
+	err = p.ReloadAliases()
+	if err != nil {
+		log.WithError(err).WithField("filename", p.cfg.AliasesFile).Error("error reloading aliases")
+		return lastMod
+	}
+	log.WithField("filename", p.cfg.AliasesFile).Info("aliases reloaded")
+	return st.ModTime()
+}
+
+// ExplainCallsign describes how the callsign would be resolved at the moment
+func (p *Provider) ExplainCallsign(callsign string) Resolution {
+	p.dataLock.RLock()
+	defer p.dataLock.RUnlock()
+
+	key, alias := p.resolveCallsignUnsafe(callsign)
+	r := Resolution{Callsign: callsign, Key: key, Alias: alias}
+	if alias != nil {
+		r.Steps = append(r.Steps, fmt.Sprintf("matched %s alias '%s' -> '%s'", alias.Match, alias.Pattern, key))
+	} else {
+		r.Steps = append(r.Steps, fmt.Sprintf("no alias found, using callsign prefix '%s'", key))
+	}
+
+	if arpt, err := p.findAirportUnsafe(key); err == nil {
+		r.Airport = arpt.Meta.ICAO
+		r.Steps = append(r.Steps, fmt.Sprintf("'%s' is airport %s", key, arpt.Meta.ICAO))
+	} else {
+		r.Steps = append(r.Steps, fmt.Sprintf("'%s' is not an airport ICAO or IATA code", key))
+	}
+
+	if cov, err := p.findCoverageUnsafe(key, log); err == nil {
+		r.FIRs = cov.firIDs()
+		r.Steps = append(r.Steps, fmt.Sprintf("'%s' covers FIRs %s", key, strings.Join(r.FIRs, ", ")))
+	} else {
+		r.Steps = append(r.Steps, fmt.Sprintf("'%s' can't be resolved to any FIR", key))
+	}
+
+	return r
+}
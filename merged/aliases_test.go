@@ -0,0 +1,143 @@
+package merged
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	vatsimapi "github.com/vatsimnerd/simwatch-providers/vatsim-api"
+	vatspydata "github.com/vatsimnerd/simwatch-providers/vatspy-data"
+)
+
+func TestAliasTableFind(t *testing.T) {
+	table, err := newAliasTable([]Alias{
+		{Match: AliasMatchExact, Pattern: "NY_CAM_GND", Airport: "KJFK"},
+		{Match: AliasMatchPrefix, Pattern: "LON", FIR: "EGTT"},
+		{Match: AliasMatchPrefix, Pattern: "LON_S", FIR: "EGTT-S"},
+		{Match: AliasMatchRegex, Pattern: `^EDWW_[A-Z]_CTR$`, FIR: "EDWW"},
+		{Match: AliasMatchRegex, Pattern: `^ED`, UIR: "EURW"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	testcases := []struct {
+		callsign string
+		key      string
+	}{
+		{"NY_CAM_GND", "KJFK"},
+		{"LON_S_CTR", "EGTT-S"},
+		{"LON_CTR", "EGTT"},
+		{"EDWW_B_CTR", "EDWW"},
+		{"EDMM_CTR", "EURW"},
+		{"EGLL_TWR", ""},
+	}
+
+	for _, tc := range testcases {
+		a := table.find(tc.callsign)
+		key := ""
+		if a != nil {
+			key = a.key()
+		}
+		if key != tc.key {
+			t.Errorf("%s: expected '%s', got '%s'", tc.callsign, tc.key, key)
+		}
+	}
+}
+
+func TestAliasTableInvalid(t *testing.T) {
+	_, err := newAliasTable([]Alias{{Match: AliasMatchRegex, Pattern: "(", FIR: "EGTT"}})
+	if err == nil {
+		t.Error("expected invalid regex error")
+	}
+	_, err = newAliasTable([]Alias{{Match: AliasMatchExact, Pattern: "LON_CTR"}})
+	if err == nil {
+		t.Error("expected missing target error")
+	}
+}
+
+func TestAliasedController(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "aliases.json")
+	err := os.WriteFile(filename, []byte(`[{"match": "exact", "pattern": "NY_CAM_GND", "airport": "KJFK"}]`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := New(nil, nil, nil)
+	p.SetConfig(&Config{AliasesFile: filename})
+	if err := p.ReloadAliases(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	p.setAirport(vatspydata.AirportMeta{ICAO: "KJFK", IATA: "JFK", Name: "John F Kennedy"})
+
+	gnd := vatsimapi.Controller{Callsign: "NY_CAM_GND", Facility: vatsimapi.FacilityGround}
+	p.setController(gnd)
+	arpt, _ := p.GetAirport("KJFK")
+	if len(arpt.Controllers.Ground) != 1 {
+		t.Errorf("expected aliased ground at KJFK, got %+v", arpt.Controllers)
+	}
+
+	r := p.ExplainCallsign("NY_CAM_GND")
+	if r.Key != "KJFK" || r.Alias == nil || r.Airport != "KJFK" {
+		t.Errorf("unexpected resolution %+v", r)
+	}
+
+	p.deleteController(gnd)
+	arpt, _ = p.GetAirport("KJFK")
+	if arpt.IsControlled() {
+		t.Errorf("expected airport to be uncontrolled, got %+v", arpt.Controllers)
+	}
+}
+
+func TestAliasedControllerReload(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "aliases.json")
+	writeAliases := func(airport string) {
+		data := `[{"match": "exact", "pattern": "NY_CAM_GND", "airport": "` + airport + `"}]`
+		if err := os.WriteFile(filename, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := New(nil, nil, nil)
+	p.SetConfig(&Config{AliasesFile: filename})
+	p.setAirport(vatspydata.AirportMeta{ICAO: "KJFK", IATA: "JFK", Name: "John F Kennedy"})
+	p.setAirport(vatspydata.AirportMeta{ICAO: "KLGA", IATA: "LGA", Name: "La Guardia"})
+
+	writeAliases("KJFK")
+	if err := p.ReloadAliases(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	gnd := vatsimapi.Controller{Callsign: "NY_CAM_GND", Facility: vatsimapi.FacilityGround}
+	p.setController(gnd)
+
+	// the controller stays online without any changes in the feed
+	writeAliases("KLGA")
+	if err := p.ReloadAliases(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	jfk, _ := p.GetAirport("KJFK")
+	if jfk.IsControlled() {
+		t.Errorf("expected KJFK to be uncontrolled after re-targeting, got %+v", jfk.Controllers)
+	}
+	lga, _ := p.GetAirport("KLGA")
+	if len(lga.Controllers.Ground) != 1 {
+		t.Errorf("expected re-targeted ground at KLGA, got %+v", lga.Controllers)
+	}
+	if ctrl, err := p.GetController("NY_CAM_GND"); err != nil || ctrl.AirportICAO != "KLGA" {
+		t.Errorf("expected controller to be resolved to KLGA, got %+v, error %v", ctrl, err)
+	}
+
+	// the next feed update doesn't change anything
+	p.setController(gnd)
+	lga, _ = p.GetAirport("KLGA")
+	if len(lga.Controllers.Ground) != 1 {
+		t.Errorf("expected ground at KLGA, got %+v", lga.Controllers)
+	}
+
+	p.deleteController(gnd)
+	lga, _ = p.GetAirport("KLGA")
+	if lga.IsControlled() {
+		t.Errorf("expected KLGA to be uncontrolled, got %+v", lga.Controllers)
+	}
+}
@@ -0,0 +1,245 @@
+package merged
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	vatsimapi "github.com/vatsimnerd/simwatch-providers/vatsim-api"
+)
+
+type (
+	Wind struct {
+		Direction int  `json:"dir"`
+		Variable  bool `json:"variable"`
+		Speed     int  `json:"speed"`
+		Gust      int  `json:"gust,omitempty"`
+	}
+
+	// DecodedATIS is a structured representation of ATIS text. Zero values
+	// mean the corresponding item hasn't been found in the text.
+	DecodedATIS struct {
+		Callsign           string  `json:"callsign"`
+		Letter             string  `json:"letter"`
+		LetterMatchesCode  bool    `json:"letter_matches_code"`
+		QNHhPa             int     `json:"qnh_hpa,omitempty"`
+		QNHinHg            float64 `json:"qnh_inhg,omitempty"`
+		TransitionLevel    int     `json:"transition_level,omitempty"`
+		TransitionAltitude int     `json:"transition_altitude,omitempty"`
+		Wind               *Wind   `json:"wind,omitempty"`
+		VisibilityM        int     `json:"visibility_m,omitempty"`
+		Approach           string  `json:"approach,omitempty"`
+		ObservationTime    string  `json:"observation_time,omitempty"`
+	}
+)
+
+const (
+	hPaPerInHg = 33.8639
+
+	approachTypes = `ILS|RNAV|RNP|GNSS|GLS|VOR|NDB|LOC|LDA|VISUAL`
+)
+
+var (
+	phoneticAlphabet = map[string]string{
+		"ALFA": "A", "ALPHA": "A", "BRAVO": "B", "CHARLIE": "C", "DELTA": "D",
+		"ECHO": "E", "FOXTROT": "F", "GOLF": "G", "HOTEL": "H", "INDIA": "I",
+		"JULIET": "J", "JULIETT": "J", "KILO": "K", "LIMA": "L", "MIKE": "M",
+		"NOVEMBER": "N", "OSCAR": "O", "PAPA": "P", "QUEBEC": "Q", "ROMEO": "R",
+		"SIERRA": "S", "TANGO": "T", "UNIFORM": "U", "VICTOR": "V", "WHISKEY": "W",
+		"WHISKY": "W", "XRAY": "X", "YANKEE": "Y", "ZULU": "Z",
+	}
+
+	exprSpokenAbbr = map[string]*regexp.Regexp{
+		"QNH":  regexp.MustCompile(`\bQ N H\b`),
+		"QFE":  regexp.MustCompile(`\bQ F E\b`),
+		"UTC":  regexp.MustCompile(`\bU T C\b`),
+		"ILS":  regexp.MustCompile(`\bI L S\b`),
+		"RNAV": regexp.MustCompile(`\bR N A V\b`),
+	}
+
+	exprLetter = regexp.MustCompile(
+		`\b(?:INFORMATION|INFO|ATIS)\s([A-Z]|ALFA|ALPHA|BRAVO|CHARLIE|DELTA|ECHO|FOXTROT|GOLF|HOTEL|INDIA|JULIETT?|KILO|LIMA|MIKE|NOVEMBER|OSCAR|PAPA|QUEBEC|ROMEO|SIERRA|TANGO|UNIFORM|VICTOR|WHISKE?Y|XRAY|YANKEE|ZULU)\b`,
+	)
+
+	exprQNH          = regexp.MustCompile(`\bQNH\s(\d{3,4})\b`)
+	exprMetarQNH     = regexp.MustCompile(`\bQ(\d{4})\b`)
+	exprAltimeter    = regexp.MustCompile(`\bALTIMETER\s(\d{4})\b`)
+	exprMetarAltim   = regexp.MustCompile(`\bA(\d{4})\b`)
+	exprTransLevel   = regexp.MustCompile(`\b(?:TRANSITION\sLEVEL|TRL|TL)\s(?:FLIGHT\sLEVEL\s|FL\s?)?(\d{2,3})\b`)
+	exprTransAlt     = regexp.MustCompile(`\b(?:TRANSITION\sALTITUDE|TA)\s(\d{3,5})\b`)
+	exprWindCalm     = regexp.MustCompile(`\bWIND\sCALM\b`)
+	exprWind         = regexp.MustCompile(`\bWIND\s(\d{3}|VARIABLE|VRB)\s(?:DEGREES\s)?(\d{1,3})\s(?:KNOTS|KTS|KT)(?:\s(?:GUSTS|GUSTING)(?:\sUP\sTO)?\s(\d{1,3}))?`)
+	exprMetarWind    = regexp.MustCompile(`\b(\d{3}|VRB)(\d{2,3})(?:G(\d{2,3}))?KT\b`)
+	exprVisibility   = regexp.MustCompile(`\bVISIBILITY\s(?:MORE\sTHAN\s)?(\d{1,5})\s?(KILOMETERS|KILOMETRES|KM|METERS|METRES|M|MILES|SM)\b`)
+	exprMetarVis     = regexp.MustCompile(`KT\s(?:\d{3}V\d{3}\s)?(\d{4})\b`)
+	exprMetarVisSM   = regexp.MustCompile(`\b(\d{1,2})SM\b`)
+	exprCAVOK        = regexp.MustCompile(`\bCAVOK\b`)
+	exprApproach     = regexp.MustCompile(`\bEXPECT(?:ED)?\s(?:APPROACH\s)?(` + approachTypes + `)\b`)
+	exprApproachIn   = regexp.MustCompile(`\b(` + approachTypes + `)\s(?:[A-Z]\s)?(?:(?:RWY|RUNWAY)\s\d{2}[LRC]?\s)?APPROACH`)
+	exprObsTime      = regexp.MustCompile(`\b(?:TIME|RECORDED\sAT|METREPORT|OBSERVATION(?:\sTIME)?|WEATHER\sAT)\s(\d{4})\b`)
+	exprMetarObsTime = regexp.MustCompile(`\b(?:\d{2})?(\d{4})\s?Z\b`)
+)
+
+// normalizeDecodeText prepares ATIS text for decoding. Unlike normalizeAtisText
+// it collapses spoken-style numbers ("1 0 0 1") before removing punctuation,
+// so numbers separated by a comma or a period are kept apart.
+func normalizeDecodeText(text string) string {
+	text = strings.ToUpper(text)
+	text = exprWhitespace.ReplaceAllString(text, " ")
+	for abbr, re := range exprSpokenAbbr {
+		text = re.ReplaceAllString(text, abbr)
+	}
+	for {
+		collapsed := exprCollapseNumbers.ReplaceAllString(text, `$1$2`)
+		if collapsed == text {
+			break
+		}
+		text = collapsed
+	}
+	text = exprSpecial.ReplaceAllString(text, "")
+	text = exprWhitespace.ReplaceAllString(text, " ")
+	return strings.TrimSpace(text)
+}
+
+func findInt(re *regexp.Regexp, text string) (int, bool) {
+	m := re.FindStringSubmatch(text)
+	if m == nil {
+		return 0, false
+	}
+	v, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 0, false
+	}
+	return v, true
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+func (d *DecodedATIS) decodePressure(text string) {
+	if qnh, ok := findInt(exprQNH, text); ok {
+		if qnh >= 2800 && qnh <= 3200 {
+			// inHg reported as QNH
+			d.QNHinHg = float64(qnh) / 100
+			d.QNHhPa = int(math.Round(d.QNHinHg * hPaPerInHg))
+		} else {
+			d.QNHhPa = qnh
+			d.QNHinHg = round2(float64(qnh) / hPaPerInHg)
+		}
+		return
+	}
+	if qnh, ok := findInt(exprMetarQNH, text); ok {
+		d.QNHhPa = qnh
+		d.QNHinHg = round2(float64(qnh) / hPaPerInHg)
+		return
+	}
+	for _, re := range []*regexp.Regexp{exprAltimeter, exprMetarAltim} {
+		if alt, ok := findInt(re, text); ok {
+			d.QNHinHg = float64(alt) / 100
+			d.QNHhPa = int(math.Round(d.QNHinHg * hPaPerInHg))
+			return
+		}
+	}
+}
+
+func (d *DecodedATIS) decodeWind(text string) {
+	if exprWindCalm.MatchString(text) {
+		d.Wind = &Wind{}
+		return
+	}
+	for _, re := range []*regexp.Regexp{exprWind, exprMetarWind} {
+		m := re.FindStringSubmatch(text)
+		if m == nil {
+			continue
+		}
+		w := &Wind{}
+		if m[1] == "VRB" || m[1] == "VARIABLE" {
+			w.Variable = true
+		} else {
+			w.Direction, _ = strconv.Atoi(m[1])
+		}
+		w.Speed, _ = strconv.Atoi(m[2])
+		if m[3] != "" {
+			w.Gust, _ = strconv.Atoi(m[3])
+		}
+		d.Wind = w
+		return
+	}
+}
+
+func (d *DecodedATIS) decodeVisibility(text string) {
+	if m := exprVisibility.FindStringSubmatch(text); m != nil {
+		v, _ := strconv.Atoi(m[1])
+		switch m[2] {
+		case "KILOMETERS", "KILOMETRES", "KM":
+			d.VisibilityM = v * 1000
+		case "MILES", "SM":
+			d.VisibilityM = int(math.Round(float64(v) * 1609.344))
+		default:
+			d.VisibilityM = v
+		}
+		return
+	}
+	if exprCAVOK.MatchString(text) {
+		d.VisibilityM = 10000
+		return
+	}
+	if v, ok := findInt(exprMetarVis, text); ok {
+		d.VisibilityM = v
+		return
+	}
+	if v, ok := findInt(exprMetarVisSM, text); ok {
+		d.VisibilityM = int(math.Round(float64(v) * 1609.344))
+	}
+}
+
+func decodeATIS(c vatsimapi.Controller) DecodedATIS {
+	d := DecodedATIS{Callsign: c.Callsign}
+	text := normalizeDecodeText(c.TextAtis)
+
+	if m := exprLetter.FindStringSubmatch(text); m != nil {
+		d.Letter = m[1]
+		if letter, found := phoneticAlphabet[d.Letter]; found {
+			d.Letter = letter
+		}
+	}
+	d.LetterMatchesCode = d.Letter != "" && strings.EqualFold(d.Letter, strings.TrimSpace(c.AtisCode))
+
+	d.decodePressure(text)
+	d.TransitionLevel, _ = findInt(exprTransLevel, text)
+	d.TransitionAltitude, _ = findInt(exprTransAlt, text)
+	d.decodeWind(text)
+	d.decodeVisibility(text)
+
+	if m := exprApproach.FindStringSubmatch(text); m != nil {
+		d.Approach = m[1]
+	} else if m := exprApproachIn.FindStringSubmatch(text); m != nil {
+		d.Approach = m[1]
+	}
+
+	if m := exprObsTime.FindStringSubmatch(text); m != nil {
+		d.ObservationTime = m[1]
+	} else if m := exprMetarObsTime.FindStringSubmatch(text); m != nil {
+		d.ObservationTime = m[1]
+	}
+
+	return d
+}
+
+func (d DecodedATIS) Copy() DecodedATIS {
+	cp := d
+	if d.Wind != nil {
+		w := *d.Wind
+		cp.Wind = &w
+	}
+	return cp
+}
+
+func (a *Airport) setDecodedATIS() {
+	a.DecodedATIS = make(map[string]DecodedATIS, len(a.Controllers.ATIS))
+	for callsign, atis := range a.Controllers.ATIS {
+		a.DecodedATIS[callsign] = decodeATIS(atis)
+	}
+}
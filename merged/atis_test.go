@@ -0,0 +1,157 @@
+package merged
+
+import (
+	"testing"
+
+	vatsimapi "github.com/vatsimnerd/simwatch-providers/vatsim-api"
+)
+
+type atisTestcase struct {
+	name     string
+	atis     string
+	atisCode string
+	expected DecodedATIS
+}
+
+func corpusAtis(name string) string {
+	for _, tc := range testcases {
+		if tc.name == name {
+			return tc.atis
+		}
+	}
+	return ""
+}
+
+var (
+	atisTestcases = []atisTestcase{
+		{
+			name:     "LFPG",
+			atis:     corpusAtis("LFPG"),
+			atisCode: "Y",
+			expected: DecodedATIS{
+				Letter:            "Y",
+				LetterMatchesCode: true,
+				QNHhPa:            1001,
+				QNHinHg:           29.56,
+				TransitionLevel:   60,
+				Wind:              &Wind{Direction: 260, Speed: 9},
+				VisibilityM:       10000,
+				Approach:          "ILS",
+				ObservationTime:   "1643",
+			},
+		},
+		{
+			name:     "EDDV",
+			atis:     corpusAtis("EDDV"),
+			atisCode: "B",
+			expected: DecodedATIS{
+				Letter:          "A",
+				QNHhPa:          985,
+				QNHinHg:         29.09,
+				TransitionLevel: 70,
+				Wind:            &Wind{Direction: 270, Speed: 22, Gust: 33},
+				VisibilityM:     10000,
+				Approach:        "ILS",
+				ObservationTime: "1720",
+			},
+		},
+		{
+			name:     "EKCH",
+			atis:     corpusAtis("EKCH"),
+			atisCode: "W",
+			expected: DecodedATIS{
+				Letter:            "W",
+				LetterMatchesCode: true,
+				QNHhPa:            974,
+				QNHinHg:           28.76,
+				TransitionLevel:   75,
+				Wind:              &Wind{Direction: 200, Speed: 19},
+				VisibilityM:       10000,
+				Approach:          "ILS",
+				ObservationTime:   "1720",
+			},
+		},
+		{
+			name:     "EGKK",
+			atis:     corpusAtis("EGKK"),
+			atisCode: "C",
+			expected: DecodedATIS{
+				Letter:            "C",
+				LetterMatchesCode: true,
+				QNHhPa:            1018,
+				QNHinHg:           30.06,
+				TransitionLevel:   70,
+				Wind:              &Wind{Direction: 230, Speed: 6},
+				VisibilityM:       10000,
+				ObservationTime:   "1420",
+			},
+		},
+		{
+			name:     "EGCN",
+			atis:     corpusAtis("EGCN"),
+			atisCode: "G",
+			expected: DecodedATIS{
+				Letter:            "G",
+				LetterMatchesCode: true,
+				QNHhPa:            1020,
+				QNHinHg:           30.12,
+				Wind:              &Wind{Direction: 250, Speed: 9},
+				VisibilityM:       10000,
+				Approach:          "ILS",
+				ObservationTime:   "1050",
+			},
+		},
+		{
+			name: "KJFK",
+			atis: `KJFK ATIS INFO B 1751Z. 31012G20KT 10SM FEW250 22/08 A3002 (THREE ZERO ZERO TWO).
+			ILS RWY 22L APPROACH IN USE. DEPARTING RUNWAY 31L. TRANSITION ALTITUDE 18000.
+			ADVS YOU HAVE INFO B.`,
+			atisCode: "B",
+			expected: DecodedATIS{
+				Letter:             "B",
+				LetterMatchesCode:  true,
+				QNHhPa:             1017,
+				QNHinHg:            30.02,
+				TransitionAltitude: 18000,
+				Wind:               &Wind{Direction: 310, Speed: 12, Gust: 20},
+				VisibilityM:        16093,
+				Approach:           "ILS",
+				ObservationTime:    "1751",
+			},
+		},
+		{
+			name: "UUEE",
+			atis: `SHEREMETYEVO ATIS INFORMATION KILO 0 9 3 0 Z.
+			EXPECT R N A V APPROACH RUNWAY 2 4 LEFT. WIND VRB 2 KT. CAVOK.
+			Q N H 1 0 2 3. TRANSITION LEVEL 5 0.`,
+			atisCode: "K",
+			expected: DecodedATIS{
+				Letter:            "K",
+				LetterMatchesCode: true,
+				QNHhPa:            1023,
+				QNHinHg:           30.21,
+				TransitionLevel:   50,
+				Wind:              &Wind{Variable: true, Speed: 2},
+				VisibilityM:       10000,
+				Approach:          "RNAV",
+				ObservationTime:   "0930",
+			},
+		},
+	}
+)
+
+func TestDecodeATIS(t *testing.T) {
+	for _, tc := range atisTestcases {
+		d := decodeATIS(vatsimapi.Controller{Callsign: tc.name + "_ATIS", TextAtis: tc.atis, AtisCode: tc.atisCode})
+		exp := tc.expected
+		exp.Callsign = tc.name + "_ATIS"
+
+		if (d.Wind == nil) != (exp.Wind == nil) || (d.Wind != nil && *d.Wind != *exp.Wind) {
+			t.Errorf("[%s] wind doesn't match, expected %+v, got %+v", tc.name, exp.Wind, d.Wind)
+		}
+		d.Wind, exp.Wind = nil, nil
+		if d != exp {
+			t.Errorf("[%s] decoded ATIS doesn't match\nexpected %+v\n     got %+v", tc.name, exp, d)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package merged
+
+import (
+	"time"
+)
+
+type Config struct {
+	// AliasesFile is a JSON file with callsign aliases, see Alias
+	AliasesFile string `mapstructure:"aliases_file,omitempty"`
+	// AliasesReloadPeriod is a period of checking AliasesFile for changes,
+	// zero value disables hot reloading
+	AliasesReloadPeriod time.Duration `mapstructure:"aliases_reload_period,omitempty"`
+	// SnapshotFile is a file the state is persisted to and restored from on start
+	SnapshotFile string `mapstructure:"snapshot_file,omitempty"`
+	// SnapshotPeriod is a period of writing the snapshot, it's also
+	// written on Stop. Zero value disables periodic writing.
+	SnapshotPeriod time.Duration `mapstructure:"snapshot_period,omitempty"`
+}
@@ -0,0 +1,194 @@
+package merged
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	vatsimapi "github.com/vatsimnerd/simwatch-providers/vatsim-api"
+)
+
+// ControllerSetVersion is incremented every time ControllerSet JSON shape changes
+//
+// v1: one controller object (or null) per facility
+// v2: callsign -> controller map per facility
+const ControllerSetVersion = 2
+
+type (
+	// Controllers maps callsigns to controllers of the same facility
+	Controllers map[string]vatsimapi.Controller
+
+	// ControllerSet holds every controller of an airport by facility.
+	// ControllerSet is never modified in place, withController and
+	// withoutController return a modified copy so the sets already
+	// published to subscribers stay intact.
+	ControllerSet struct {
+		ATIS     Controllers `json:"atis"`
+		Delivery Controllers `json:"del"`
+		Ground   Controllers `json:"gnd"`
+		Tower    Controllers `json:"twr"`
+		Approach Controllers `json:"appr"`
+	}
+)
+
+func (c Controllers) NE(o Controllers) bool {
+	if len(c) != len(o) {
+		return true
+	}
+	for callsign, ctrl := range c {
+		if octrl, found := o[callsign]; !found || ctrl.NE(octrl) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c Controllers) Copy() Controllers {
+	if c == nil {
+		return nil
+	}
+	cp := make(Controllers, len(c))
+	for callsign, ctrl := range c {
+		cp[callsign] = ctrl
+	}
+	return cp
+}
+
+// Callsigns returns sorted list of callsigns
+func (c Controllers) Callsigns() []string {
+	callsigns := make([]string, 0, len(c))
+	for callsign := range c {
+		callsigns = append(callsigns, callsign)
+	}
+	sort.Strings(callsigns)
+	return callsigns
+}
+
+// First returns the controller with the lowest callsign, nil if there's none
+func (c Controllers) First() *vatsimapi.Controller {
+	if len(c) == 0 {
+		return nil
+	}
+	ctrl := c[c.Callsigns()[0]]
+	return &ctrl
+}
+
+// ATISKind tells whether ATIS station serves arrivals, departures or both
+type ATISKind int
+
+const (
+	ATISCombined ATISKind = iota
+	ATISArrival
+	ATISDeparture
+)
+
+// atisKind detects D-ATIS stations by callsign, i.e. KJFK_A_ATIS and KJFK_D_ATIS
+func atisKind(callsign string) ATISKind {
+	tokens := strings.Split(callsign, "_")
+	for _, token := range tokens[1:] {
+		switch token {
+		case "A":
+			return ATISArrival
+		case "D":
+			return ATISDeparture
+		}
+	}
+	return ATISCombined
+}
+
+func (cs ControllerSet) findATIS(preference ...ATISKind) *vatsimapi.Controller {
+	for _, kind := range preference {
+		for _, callsign := range cs.ATIS.Callsigns() {
+			if atisKind(callsign) == kind {
+				ctrl := cs.ATIS[callsign]
+				return &ctrl
+			}
+		}
+	}
+	return nil
+}
+
+// ArrivalATIS returns arrival ATIS, falling back to combined one.
+// Departure ATIS is never used for arrivals.
+func (cs ControllerSet) ArrivalATIS() *vatsimapi.Controller {
+	return cs.findATIS(ATISArrival, ATISCombined)
+}
+
+// DepartureATIS returns departure ATIS, falling back to combined one.
+// Arrival ATIS is never used for departures.
+func (cs ControllerSet) DepartureATIS() *vatsimapi.Controller {
+	return cs.findATIS(ATISDeparture, ATISCombined)
+}
+
+func (cs *ControllerSet) byFacility(facility vatsimapi.Facility) *Controllers {
+	switch facility {
+	case vatsimapi.FacilityATIS:
+		return &cs.ATIS
+	case vatsimapi.FacilityDelivery:
+		return &cs.Delivery
+	case vatsimapi.FacilityGround:
+		return &cs.Ground
+	case vatsimapi.FacilityTower:
+		return &cs.Tower
+	case vatsimapi.FacilityApproach:
+		return &cs.Approach
+	}
+	return nil
+}
+
+func (cs ControllerSet) withController(c vatsimapi.Controller) ControllerSet {
+	cp := cs.Copy()
+	// the callsign might have been online with another facility
+	for _, ctrls := range []Controllers{cp.ATIS, cp.Delivery, cp.Ground, cp.Tower, cp.Approach} {
+		delete(ctrls, c.Callsign)
+	}
+	if ctrls := cp.byFacility(c.Facility); ctrls != nil {
+		if *ctrls == nil {
+			*ctrls = make(Controllers)
+		}
+		(*ctrls)[c.Callsign] = c
+	}
+	return cp
+}
+
+func (cs ControllerSet) withoutController(c vatsimapi.Controller) ControllerSet {
+	cp := cs.Copy()
+	if ctrls := cp.byFacility(c.Facility); ctrls != nil {
+		delete(*ctrls, c.Callsign)
+	}
+	return cp
+}
+
+func (cs ControllerSet) NE(o ControllerSet) bool {
+	return cs.ATIS.NE(o.ATIS) ||
+		cs.Delivery.NE(o.Delivery) ||
+		cs.Ground.NE(o.Ground) ||
+		cs.Tower.NE(o.Tower) ||
+		cs.Approach.NE(o.Approach)
+}
+
+func (cs ControllerSet) IsEmpty() bool {
+	return len(cs.ATIS) == 0 &&
+		len(cs.Delivery) == 0 &&
+		len(cs.Ground) == 0 &&
+		len(cs.Tower) == 0 &&
+		len(cs.Approach) == 0
+}
+
+func (cs ControllerSet) Copy() ControllerSet {
+	return ControllerSet{
+		ATIS:     cs.ATIS.Copy(),
+		Delivery: cs.Delivery.Copy(),
+		Ground:   cs.Ground.Copy(),
+		Tower:    cs.Tower.Copy(),
+		Approach: cs.Approach.Copy(),
+	}
+}
+
+func (cs ControllerSet) MarshalJSON() ([]byte, error) {
+	type plain ControllerSet
+	return json.Marshal(struct {
+		Version int `json:"version"`
+		plain
+	}{ControllerSetVersion, plain(cs)})
+}
@@ -0,0 +1,68 @@
+package merged
+
+import (
+	"strings"
+	"testing"
+
+	vatsimapi "github.com/vatsimnerd/simwatch-providers/vatsim-api"
+	vatspydata "github.com/vatsimnerd/simwatch-providers/vatspy-data"
+)
+
+func TestSeveralControllersPerFacility(t *testing.T) {
+	p := New(nil, nil, nil)
+	p.setAirport(vatspydata.AirportMeta{ICAO: "EGLL", IATA: "LHR", Name: "Heathrow"})
+
+	ctrl := func(callsign string, facility vatsimapi.Facility) vatsimapi.Controller {
+		return vatsimapi.Controller{Callsign: callsign, Facility: facility}
+	}
+
+	testcases := []struct {
+		name       string
+		ctrl       vatsimapi.Controller
+		logoff     bool
+		tower      string
+		ground     string
+		controlled bool
+	}{
+		{"first tower", ctrl("EGLL_N_TWR", vatsimapi.FacilityTower), false, "EGLL_N_TWR", "", true},
+		{"second tower", ctrl("EGLL_S_TWR", vatsimapi.FacilityTower), false, "EGLL_N_TWR,EGLL_S_TWR", "", true},
+		{"ground", ctrl("EGLL_GND", vatsimapi.FacilityGround), false, "EGLL_N_TWR,EGLL_S_TWR", "EGLL_GND", true},
+		{"same tower again", ctrl("EGLL_S_TWR", vatsimapi.FacilityTower), false, "EGLL_N_TWR,EGLL_S_TWR", "EGLL_GND", true},
+		{"first tower logoff", ctrl("EGLL_N_TWR", vatsimapi.FacilityTower), true, "EGLL_S_TWR", "EGLL_GND", true},
+		{"unknown tower logoff", ctrl("EGLL_X_TWR", vatsimapi.FacilityTower), true, "EGLL_S_TWR", "EGLL_GND", true},
+		{"ground logoff", ctrl("EGLL_GND", vatsimapi.FacilityGround), true, "EGLL_S_TWR", "", true},
+		{"second tower logoff", ctrl("EGLL_S_TWR", vatsimapi.FacilityTower), true, "", "", false},
+		{"ground again", ctrl("EGLL_GND", vatsimapi.FacilityGround), false, "", "EGLL_GND", true},
+		{"ground becomes tower", ctrl("EGLL_GND", vatsimapi.FacilityTower), false, "EGLL_GND", "", true},
+	}
+
+	for _, tc := range testcases {
+		before, _ := p.GetAirport("EGLL")
+		beforeTower := strings.Join(before.Controllers.Tower.Callsigns(), ",")
+
+		if tc.logoff {
+			p.deleteController(tc.ctrl)
+		} else {
+			p.setController(tc.ctrl)
+		}
+
+		arpt, _ := p.GetAirport("EGLL")
+		tower := strings.Join(arpt.Controllers.Tower.Callsigns(), ",")
+		ground := strings.Join(arpt.Controllers.Ground.Callsigns(), ",")
+		if tower != tc.tower || ground != tc.ground {
+			t.Errorf("%s: expected tower [%s] and ground [%s], got [%s] and [%s]", tc.name, tc.tower, tc.ground, tower, ground)
+		}
+		if arpt.IsControlled() != tc.controlled {
+			t.Errorf("%s: expected controlled to be %v", tc.name, tc.controlled)
+		}
+		if first := arpt.Controllers.Tower.First(); tc.tower != "" && (first == nil || first.Callsign != strings.Split(tc.tower, ",")[0]) {
+			t.Errorf("%s: unexpected first tower %v", tc.name, first)
+		}
+
+		// airports are published with their controller sets, previously
+		// published sets must stay intact
+		if after := strings.Join(before.Controllers.Tower.Callsigns(), ","); after != beforeTower {
+			t.Errorf("%s: previous controller set is modified from [%s] to [%s]", tc.name, beforeTower, after)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package merged
+
+import (
+	"sort"
+	"time"
+
+	vatsimapi "github.com/vatsimnerd/simwatch-providers/vatsim-api"
+	"github.com/vatsimnerd/util/pubsub"
+)
+
+type (
+	EventType string
+
+	ActiveRunways struct {
+		Landing []string `json:"landing"`
+		TakeOff []string `json:"takeoff"`
+	}
+
+	// Event is a semantic change derived from consecutive object states.
+	// Events are published with ObjectTypeEvent to the event subscriptions,
+	// see SubscribeEvents.
+	Event struct {
+		Type        EventType      `json:"type"`
+		Time        time.Time      `json:"time"`
+		Callsign    string         `json:"callsign,omitempty"`
+		AirportICAO string         `json:"airport,omitempty"`
+		FIRIDs      []string       `json:"firs,omitempty"`
+		From        string         `json:"from,omitempty"`
+		To          string         `json:"to,omitempty"`
+		PrevRunways *ActiveRunways `json:"prev_runways,omitempty"`
+		Runways     *ActiveRunways `json:"runways,omitempty"`
+	}
+
+	// airportState is the part of an airport events are derived from
+	airportState struct {
+		controlled  bool
+		atisLetters map[string]string
+		runways     ActiveRunways
+	}
+)
+
+const (
+	EventPilotConnected      EventType = "pilot_connected"
+	EventPilotDisconnected   EventType = "pilot_disconnected"
+	EventPilotDeparted       EventType = "pilot_departed"
+	EventPilotLanded         EventType = "pilot_landed"
+	EventControllerOnline    EventType = "controller_online"
+	EventControllerOffline   EventType = "controller_offline"
+	EventATISLetterChanged   EventType = "atis_letter_changed"
+	EventActiveRunwayChanged EventType = "active_runway_changed"
+	EventAirportControlled   EventType = "airport_controlled"
+	EventAirportUncontrolled EventType = "airport_uncontrolled"
+	EventFlightPlanFiled     EventType = "flight_plan_filed"
+	EventFlightPlanAmended   EventType = "flight_plan_amended"
+	EventPhaseChanged        EventType = "phase_changed"
+)
+
+// SubscribeEvents creates a subscription receiving derived events only
+func (p *Provider) SubscribeEvents(chSize int) pubsub.Subscription {
+	return p.events.Subscribe(chSize)
+}
+
+func (p *Provider) UnsubscribeEvents(sub pubsub.Subscription) {
+	p.events.Unsubscribe(sub)
+}
+
+func (p *Provider) emitEvent(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	p.events.Notify(pubsub.Update{UType: pubsub.UpdateTypeSet, OType: ObjectTypeEvent, Obj: e})
+}
+
+func (e Event) Copy() Event {
+	cp := e
+	if e.FIRIDs != nil {
+		cp.FIRIDs = make([]string, len(e.FIRIDs))
+		copy(cp.FIRIDs, e.FIRIDs)
+	}
+	if e.PrevRunways != nil {
+		r := e.PrevRunways.Copy()
+		cp.PrevRunways = &r
+	}
+	if e.Runways != nil {
+		r := e.Runways.Copy()
+		cp.Runways = &r
+	}
+	return cp
+}
+
+func (r ActiveRunways) Copy() ActiveRunways {
+	cp := ActiveRunways{
+		Landing: make([]string, len(r.Landing)),
+		TakeOff: make([]string, len(r.TakeOff)),
+	}
+	copy(cp.Landing, r.Landing)
+	copy(cp.TakeOff, r.TakeOff)
+	return cp
+}
+
+func (r ActiveRunways) NE(o ActiveRunways) bool {
+	if len(r.Landing) != len(o.Landing) || len(r.TakeOff) != len(o.TakeOff) {
+		return true
+	}
+	for i := range r.Landing {
+		if r.Landing[i] != o.Landing[i] {
+			return true
+		}
+	}
+	for i := range r.TakeOff {
+		if r.TakeOff[i] != o.TakeOff[i] {
+			return true
+		}
+	}
+	return false
+}
+
+func (a Airport) activeRunways() ActiveRunways {
+	r := ActiveRunways{Landing: make([]string, 0), TakeOff: make([]string, 0)}
+	for ident, rwy := range a.Runways {
+		if rwy.ActiveLnd {
+			r.Landing = append(r.Landing, ident)
+		}
+		if rwy.ActiveTO {
+			r.TakeOff = append(r.TakeOff, ident)
+		}
+	}
+	sort.Strings(r.Landing)
+	sort.Strings(r.TakeOff)
+	return r
+}
+
+// state must be taken before the airport is modified as runways
+// are shared between airport copies
+func (a Airport) state() airportState {
+	s := airportState{
+		controlled:  a.IsControlled(),
+		atisLetters: make(map[string]string),
+		runways:     a.activeRunways(),
+	}
+	for callsign, atis := range a.Controllers.ATIS {
+		s.atisLetters[callsign] = atisLetter(atis, a.DecodedATIS)
+	}
+	return s
+}
+
+func atisLetter(atis vatsimapi.Controller, decoded map[string]DecodedATIS) string {
+	if atis.AtisCode != "" {
+		return atis.AtisCode
+	}
+	return decoded[atis.Callsign].Letter
+}
+
+func (p *Provider) emitAirportEventsUnsafe(prev airportState, arpt Airport, ts time.Time) {
+	cur := arpt.state()
+	icao := arpt.Meta.ICAO
+
+	if !prev.controlled && cur.controlled {
+		p.emitEvent(Event{Type: EventAirportControlled, Time: ts, AirportICAO: icao})
+	} else if prev.controlled && !cur.controlled {
+		p.emitEvent(Event{Type: EventAirportUncontrolled, Time: ts, AirportICAO: icao})
+	}
+
+	for callsign, letter := range cur.atisLetters {
+		// a new ATIS is reported as controller online
+		if prevLetter, found := prev.atisLetters[callsign]; found && prevLetter != letter {
+			p.emitEvent(Event{
+				Type:        EventATISLetterChanged,
+				Time:        ts,
+				Callsign:    callsign,
+				AirportICAO: icao,
+				From:        prevLetter,
+				To:          letter,
+			})
+		}
+	}
+
+	if prev.runways.NE(cur.runways) {
+		p.emitEvent(Event{
+			Type:        EventActiveRunwayChanged,
+			Time:        ts,
+			AirportICAO: icao,
+			PrevRunways: &prev.runways,
+			Runways:     &cur.runways,
+		})
+	}
+}
+
+func (p *Provider) emitPilotEventsUnsafe(prev *Pilot, pilot Pilot) {
+	ts := pilot.LastUpdated
+	if prev == nil {
+		p.emitEvent(Event{Type: EventPilotConnected, Time: ts, Callsign: pilot.Callsign})
+		if pilot.FlightPlan != nil {
+			p.emitEvent(flightPlanEvent(EventFlightPlanFiled, pilot))
+		}
+		return
+	}
+
+	if prev.FlightPlan == nil && pilot.FlightPlan != nil {
+		p.emitEvent(flightPlanEvent(EventFlightPlanFiled, pilot))
+	} else if prev.FlightPlan != nil && pilot.FlightPlan != nil && *prev.FlightPlan != *pilot.FlightPlan {
+		p.emitEvent(flightPlanEvent(EventFlightPlanAmended, pilot))
+	}
+
+	if prev.Phase != pilot.Phase {
+		p.emitEvent(Event{
+			Type:     EventPhaseChanged,
+			Time:     ts,
+			Callsign: pilot.Callsign,
+			From:     string(prev.Phase),
+			To:       string(pilot.Phase),
+		})
+	}
+
+	// airports are reported the same way traffic is indexed, flight plan
+	// codes which can't be resolved are omitted
+	if prev.Phase.isBeforeTakeOff() && pilot.Phase.isAirborne() {
+		dep, _ := p.resolveFlightPlanUnsafe(&pilot)
+		p.emitEvent(Event{Type: EventPilotDeparted, Time: ts, Callsign: pilot.Callsign, AirportICAO: dep})
+	} else if prev.Phase.isAirborne() && pilot.Phase.isAfterLanding() {
+		_, arr := p.resolveFlightPlanUnsafe(&pilot)
+		p.emitEvent(Event{Type: EventPilotLanded, Time: ts, Callsign: pilot.Callsign, AirportICAO: arr})
+	}
+}
+
+func flightPlanEvent(t EventType, pilot Pilot) Event {
+	return Event{
+		Type:     t,
+		Time:     pilot.LastUpdated,
+		Callsign: pilot.Callsign,
+		From:     pilot.FlightPlan.Departure,
+		To:       pilot.FlightPlan.Arrival,
+	}
+}
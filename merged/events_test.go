@@ -0,0 +1,184 @@
+package merged
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vatsimnerd/simwatch-providers/ourairports"
+	vatsimapi "github.com/vatsimnerd/simwatch-providers/vatsim-api"
+	vatspydata "github.com/vatsimnerd/simwatch-providers/vatspy-data"
+	"github.com/vatsimnerd/util/pubsub"
+)
+
+func eventTypes(sub pubsub.Subscription) []EventType {
+	types := make([]EventType, 0)
+	for _, upd := range drain(sub) {
+		if e, ok := upd.Obj.(Event); ok {
+			types = append(types, e.Type)
+		}
+	}
+	return types
+}
+
+func expectEvents(t *testing.T, sub pubsub.Subscription, expected ...EventType) {
+	t.Helper()
+	got := eventTypes(sub)
+	if len(got) != len(expected) {
+		t.Errorf("expected events %v, got %v", expected, got)
+		return
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("expected events %v, got %v", expected, got)
+			return
+		}
+	}
+}
+
+func TestControllerEvents(t *testing.T) {
+	p := New(nil, nil, nil)
+	p.setAirport(vatspydata.AirportMeta{ICAO: "EGLL", IATA: "LHR", Name: "Heathrow"})
+	sub := p.SubscribeEvents(64)
+
+	atis := vatsimapi.Controller{Callsign: "EGLL_ATIS", Facility: vatsimapi.FacilityATIS, AtisCode: "A"}
+	p.setController(atis)
+	expectEvents(t, sub, EventControllerOnline, EventAirportControlled)
+
+	p.setController(atis)
+	expectEvents(t, sub)
+
+	atis.AtisCode = "B"
+	p.setController(atis)
+	expectEvents(t, sub, EventATISLetterChanged)
+
+	p.deleteController(atis)
+	expectEvents(t, sub, EventControllerOffline, EventAirportUncontrolled)
+}
+
+func TestRunwayEvents(t *testing.T) {
+	p := New(nil, nil, nil)
+	p.setAirport(vatspydata.AirportMeta{ICAO: "KJFK", IATA: "JFK", Name: "Kennedy"})
+	p.setController(vatsimapi.Controller{
+		Callsign: "KJFK_ATIS",
+		Facility: vatsimapi.FacilityATIS,
+		TextAtis: "KENNEDY INFORMATION B. LANDING RUNWAY 22L. DEPARTURE RUNWAY 31L.",
+	})
+	sub := p.SubscribeEvents(64)
+
+	// runways are loaded after the ATIS is already online
+	p.setRunway(ourairports.Runway{ICAO: "KJFK", Ident: "22L"})
+	expectEvents(t, sub, EventActiveRunwayChanged)
+
+	p.setRunway(ourairports.Runway{ICAO: "KJFK", Ident: "22L"})
+	expectEvents(t, sub)
+
+	p.setRunway(ourairports.Runway{ICAO: "KJFK", Ident: "04R"})
+	expectEvents(t, sub)
+
+	p.setRunway(ourairports.Runway{ICAO: "KJFK", Ident: "31L"})
+	expectEvents(t, sub, EventActiveRunwayChanged)
+}
+
+func TestPilotEvents(t *testing.T) {
+	p := New(nil, nil, nil)
+	sub := p.SubscribeEvents(64)
+
+	pilot := vatsimapi.Pilot{Callsign: "BAW1"}
+	p.setPilot(pilot)
+	expectEvents(t, sub, EventPilotConnected)
+
+	pilot.FlightPlan = &vatsimapi.FlightPlan{Departure: "EGLL", Arrival: "KJFK"}
+	p.setPilot(pilot)
+	expectEvents(t, sub, EventFlightPlanFiled)
+
+	fp := *pilot.FlightPlan
+	fp.Route = "DCT"
+	pilot.FlightPlan = &fp
+	p.setPilot(pilot)
+	expectEvents(t, sub, EventFlightPlanAmended)
+
+	p.deletePilot(pilot)
+	expectEvents(t, sub, EventPilotDisconnected)
+}
+
+func TestDepartedLandedAirports(t *testing.T) {
+	p := New(nil, nil, nil)
+	p.setAirport(vatspydata.AirportMeta{ICAO: "EGLL", IATA: "LHR", Position: vatspydata.Point{Lat: 51.4775, Lng: -0.4614}})
+	p.setAirport(vatspydata.AirportMeta{ICAO: "LFPG", IATA: "CDG", Position: vatspydata.Point{Lat: 49.0097, Lng: 2.5479}})
+	sub := p.SubscribeEvents(256)
+
+	// the flight plan is filed with iata codes
+	fp := &vatsimapi.FlightPlan{Departure: "LHR", Arrival: "CDG"}
+	steps := []phaseStep{
+		{51.4700, -0.4500, 80, 0, PhasePreflight},
+		{51.4770, -0.4800, 80, 140, PhaseTakeOff},
+		{50.2000, 1.3000, 35000, 460, PhaseClimb},
+		{49.0500, 2.4500, 1500, 150, PhaseApproach},
+		{49.0100, 2.5400, 390, 30, PhaseLanded},
+	}
+	ts := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i, st := range steps {
+		p.setPilot(vatsimapi.Pilot{
+			Callsign:    "BAW304",
+			Latitude:    st.lat,
+			Longitude:   st.lng,
+			Altitude:    st.alt,
+			Groundspeed: st.gs,
+			FlightPlan:  fp,
+			LastUpdated: ts.Add(time.Duration(i) * time.Minute),
+		})
+	}
+
+	expected := map[EventType]string{EventPilotDeparted: "EGLL", EventPilotLanded: "LFPG"}
+	for _, upd := range drain(sub) {
+		e, ok := upd.Obj.(Event)
+		if !ok {
+			continue
+		}
+		if icao, found := expected[e.Type]; found {
+			if e.AirportICAO != icao {
+				t.Errorf("%s: expected airport %s, got '%s'", e.Type, icao, e.AirportICAO)
+			}
+			delete(expected, e.Type)
+		}
+	}
+	if len(expected) > 0 {
+		t.Errorf("events %v are not emitted", expected)
+	}
+}
+
+func TestDisconnectEventsTime(t *testing.T) {
+	p := New(nil, nil, nil)
+	p.setAirport(vatspydata.AirportMeta{ICAO: "EGLL", IATA: "LHR", Name: "Heathrow"})
+	sub := p.SubscribeEvents(64)
+
+	// replayed feed, its time is far from the wall clock
+	connected := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+	p.setGeneral(vatsimapi.GeneralInfo{General: vatsimapi.General{UpdateTimestamp: connected.Format(time.RFC3339Nano)}})
+	p.setPilot(vatsimapi.Pilot{Callsign: "BAW1", LastUpdated: connected})
+	p.setController(vatsimapi.Controller{Callsign: "EGLL_TWR", Facility: vatsimapi.FacilityTower, LastUpdated: connected})
+	drain(sub)
+
+	disconnected := connected.Add(15 * time.Second)
+	p.setGeneral(vatsimapi.GeneralInfo{General: vatsimapi.General{UpdateTimestamp: disconnected.Format(time.RFC3339Nano)}})
+	p.deletePilot(vatsimapi.Pilot{Callsign: "BAW1"})
+	p.deleteController(vatsimapi.Controller{Callsign: "EGLL_TWR", Facility: vatsimapi.FacilityTower})
+
+	count := 0
+	for _, upd := range drain(sub) {
+		e, ok := upd.Obj.(Event)
+		if !ok {
+			continue
+		}
+		switch e.Type {
+		case EventPilotDisconnected, EventControllerOffline:
+			count++
+			if !e.Time.Equal(disconnected) {
+				t.Errorf("%s: expected time %v, got %v", e.Type, disconnected, e.Time)
+			}
+		}
+	}
+	if count != 2 {
+		t.Errorf("expected 2 disconnect events, got %d", count)
+	}
+}
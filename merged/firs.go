@@ -0,0 +1,225 @@
+package merged
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	vatsimapi "github.com/vatsimnerd/simwatch-providers/vatsim-api"
+	vatspydata "github.com/vatsimnerd/simwatch-providers/vatspy-data"
+)
+
+// coverage is a set of FIRs controlled by a radar or FSS position
+type coverage struct {
+	firs  map[string]vatspydata.FIR
+	model vatspydata.FIR
+	name  string
+}
+
+func (cov coverage) firIDs() []string {
+	ids := make([]string, 0, len(cov.firs))
+	for id := range cov.firs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// bounds returns bounding boxes of the FIRs in the order of firIDs
+func (cov coverage) bounds() []Rect {
+	ids := cov.firIDs()
+	bounds := make([]Rect, 0, len(ids))
+	for _, id := range ids {
+		b := cov.firs[id].Boundaries
+		bounds = append(bounds, Rect{Min: b.Min, Max: b.Max})
+	}
+	return bounds
+}
+
+func isAirportFacility(f vatsimapi.Facility) bool {
+	switch f {
+	case vatsimapi.FacilityATIS,
+		vatsimapi.FacilityDelivery,
+		vatsimapi.FacilityGround,
+		vatsimapi.FacilityTower,
+		vatsimapi.FacilityApproach:
+		return true
+	}
+	return false
+}
+
+// findCoverageUnsafe resolves callsign prefix to a FIR or to all FIRs of a UIR.
+// If neither is found, falls back to the FIR of an airport with the prefix,
+// to all FIRs of a country with the prefix and finally to the FIR
+// with the longest prefix matching the callsign prefix.
+func (p *Provider) findCoverageUnsafe(prefix string, clog *logrus.Entry) (coverage, error) {
+	cov, err := p.findDirectCoverageUnsafe(prefix, clog)
+	if err == nil {
+		return cov, nil
+	}
+
+	if arpt, err := p.findAirportUnsafe(prefix); err == nil && arpt.Meta.FIRID != "" {
+		if fir, err := p.findFIRUnsafe(arpt.Meta.FIRID); err == nil {
+			clog.WithField("icao", arpt.Meta.ICAO).Debug("coverage resolved by airport")
+			return singleFIRCoverage(fir), nil
+		}
+	}
+
+	// an empty country prefix would match every FIR
+	if country, found := p.countries[prefix]; found && country.Prefix != "" {
+		cov := coverage{firs: make(map[string]vatspydata.FIR), name: country.Name}
+		for id, fir := range p.firs {
+			if strings.HasPrefix(id, country.Prefix) {
+				cov.firs[id] = fir
+			}
+		}
+		if len(cov.firs) > 0 {
+			cov.model = cov.firs[cov.firIDs()[0]]
+			clog.WithField("country", country.Prefix).Debug("coverage resolved by country")
+			return cov, nil
+		}
+	}
+
+	var longest *vatspydata.FIR
+	longestLen := 0
+	for _, fir := range p.firs {
+		for _, fp := range []string{fir.ID, fir.Prefix} {
+			if len(fp) > longestLen && strings.HasPrefix(prefix, fp) {
+				f := fir
+				longest = &f
+				longestLen = len(fp)
+			}
+		}
+	}
+	if longest != nil {
+		clog.WithField("fir", longest.ID).Debug("coverage resolved by longest fir prefix")
+		return singleFIRCoverage(*longest), nil
+	}
+
+	return coverage{}, ErrNotFound
+}
+
+func singleFIRCoverage(fir vatspydata.FIR) coverage {
+	return coverage{
+		firs:  map[string]vatspydata.FIR{fir.ID: fir},
+		model: fir,
+		name:  fir.Name,
+	}
+}
+
+// findDirectCoverageUnsafe resolves callsign prefix to a FIR or to all FIRs of a UIR
+func (p *Provider) findDirectCoverageUnsafe(prefix string, clog *logrus.Entry) (coverage, error) {
+	cov := coverage{firs: make(map[string]vatspydata.FIR)}
+
+	fir, err := p.findFIRUnsafe(prefix)
+	if err == nil {
+		return singleFIRCoverage(fir), nil
+	}
+
+	uir, err := p.findUIRUnsafe(prefix)
+	if err != nil {
+		return cov, err
+	}
+
+	for _, firID := range uir.FIRIDs {
+		fir, err := p.findFIRUnsafe(firID)
+		if err == nil {
+			if len(cov.firs) == 0 {
+				cov.model = fir
+			}
+			cov.firs[fir.ID] = fir
+		} else {
+			clog.WithFields(logrus.Fields{
+				"fir": firID,
+				"uir": uir.ID,
+			}).Warn("can't find FIR provided by UIR")
+		}
+	}
+
+	if len(cov.firs) == 0 {
+		return cov, ErrNotFound
+	}
+	cov.name = uir.Name
+	return cov, nil
+}
+
+func firContains(fir vatspydata.FIR, pt vatspydata.Point) bool {
+	b := fir.Boundaries
+	// bounding box is a fast pre-filter
+	if pt.Lat < b.Min.Lat || pt.Lat > b.Max.Lat || pt.Lng < b.Min.Lng || pt.Lng > b.Max.Lng {
+		return false
+	}
+	for _, poly := range b.Points {
+		if pointInPolygon(pt, poly) {
+			return true
+		}
+	}
+	return false
+}
+
+func boundsArea(b vatspydata.Boundaries) float64 {
+	return (b.Max.Lat - b.Min.Lat) * (b.Max.Lng - b.Min.Lng)
+}
+
+// findFIRByPositionUnsafe returns the FIR containing the point. Nested FIRs are
+// resolved to the smallest one. hint is checked first as pilots tend to stay
+// within the same FIR between updates so only smaller FIRs, i.e. the ones
+// nested in it, have to be checked against their polygons.
+func (p *Provider) findFIRByPositionUnsafe(pt vatspydata.Point, hint string) (vatspydata.FIR, error) {
+	var res *vatspydata.FIR
+	if fir, found := p.firs[hint]; found && firContains(fir, pt) {
+		res = &fir
+	}
+
+	for id, fir := range p.firs {
+		if id == hint || (res != nil && boundsArea(fir.Boundaries) >= boundsArea(res.Boundaries)) {
+			continue
+		}
+		if firContains(fir, pt) {
+			f := fir
+			res = &f
+		}
+	}
+
+	if res == nil {
+		return vatspydata.FIR{}, ErrNotFound
+	}
+	return *res, nil
+}
+
+func (p *Provider) findUIRByFIRUnsafe(firID string) (vatspydata.UIR, error) {
+	for _, uir := range p.uirs {
+		for _, id := range uir.FIRIDs {
+			if id == firID {
+				return uir, nil
+			}
+		}
+	}
+	return vatspydata.UIR{}, ErrNotFound
+}
+
+// setPilotFIRUnsafe fills in FIR, UIR and country the pilot is currently flying in
+func (p *Provider) setPilotFIRUnsafe(pilot *Pilot, hint string) {
+	pilot.FIRID = ""
+	pilot.UIRID = ""
+	pilot.Country = ""
+	pilot.Oceanic = false
+
+	fir, err := p.findFIRByPositionUnsafe(pilotPosition(*pilot), hint)
+	if err != nil {
+		return
+	}
+
+	pilot.FIRID = fir.ID
+	pilot.Oceanic = fir.Boundaries.IsOceanic
+
+	if uir, err := p.findUIRByFIRUnsafe(fir.ID); err == nil {
+		pilot.UIRID = uir.ID
+	}
+
+	if len(fir.ID) >= 2 {
+		if country, found := p.countries[fir.ID[:2]]; found {
+			pilot.Country = country.Prefix
+		}
+	}
+}
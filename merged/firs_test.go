@@ -0,0 +1,97 @@
+package merged
+
+import (
+	"testing"
+
+	vatsimapi "github.com/vatsimnerd/simwatch-providers/vatsim-api"
+	vatspydata "github.com/vatsimnerd/simwatch-providers/vatspy-data"
+)
+
+func makeTestFIR(id string, polys ...[]vatspydata.Point) vatspydata.FIR {
+	b := vatspydata.Boundaries{ID: id, Points: polys, Min: polys[0][0], Max: polys[0][0]}
+	for _, poly := range polys {
+		for _, pt := range poly {
+			if pt.Lat < b.Min.Lat {
+				b.Min.Lat = pt.Lat
+			}
+			if pt.Lng < b.Min.Lng {
+				b.Min.Lng = pt.Lng
+			}
+			if pt.Lat > b.Max.Lat {
+				b.Max.Lat = pt.Lat
+			}
+			if pt.Lng > b.Max.Lng {
+				b.Max.Lng = pt.Lng
+			}
+		}
+	}
+	return vatspydata.FIR{ID: id, Name: id, Prefix: id, Boundaries: b}
+}
+
+func rectPoly(minLat, minLng, maxLat, maxLng float64) []vatspydata.Point {
+	return []vatspydata.Point{
+		{Lat: minLat, Lng: minLng},
+		{Lat: maxLat, Lng: minLng},
+		{Lat: maxLat, Lng: maxLng},
+		{Lat: minLat, Lng: maxLng},
+	}
+}
+
+func TestPilotFIRResolution(t *testing.T) {
+	p := New(nil, nil, nil)
+
+	p.setCountry(vatspydata.Country{Name: "Germany", Prefix: "ED"})
+	// EDHH fills the hole of EDWW, holes are not kept in boundaries
+	// so the smallest FIR containing the point is chosen
+	p.setFIR(makeTestFIR("EDWW", rectPoly(50, 5, 56, 15)))
+	p.setFIR(makeTestFIR("EDHH", rectPoly(52, 9, 54, 11)))
+	p.setUIR(vatspydata.UIR{ID: "EURM", Name: "Euro Middle", FIRIDs: []string{"EDWW", "EDHH"}})
+	// L-shaped FIR which bounding box covers its notch
+	p.setFIR(makeTestFIR("EKDK", []vatspydata.Point{
+		{Lat: 57, Lng: 8},
+		{Lat: 57, Lng: 15},
+		{Lat: 58, Lng: 15},
+		{Lat: 58, Lng: 9},
+		{Lat: 60, Lng: 9},
+		{Lat: 60, Lng: 8},
+	}))
+	// mainland and an island
+	p.setFIR(makeTestFIR("LFMM", rectPoly(43, 3, 46, 7), rectPoly(41, 8, 43, 10)))
+
+	testcases := []struct {
+		name    string
+		pos     vatspydata.Point
+		fir     string
+		uir     string
+		country string
+	}{
+		{"outer fir", vatspydata.Point{Lat: 51, Lng: 6}, "EDWW", "EURM", "ED"},
+		{"enclave in a hole", vatspydata.Point{Lat: 53, Lng: 10}, "EDHH", "EURM", "ED"},
+		{"concave fir", vatspydata.Point{Lat: 59, Lng: 8.5}, "EKDK", "", ""},
+		{"inside bbox outside polygon", vatspydata.Point{Lat: 59, Lng: 12}, "", "", ""},
+		{"second polygon", vatspydata.Point{Lat: 42, Lng: 9}, "LFMM", "", ""},
+		{"between polygons", vatspydata.Point{Lat: 42, Lng: 5}, "", "", ""},
+		{"outside bbox", vatspydata.Point{Lat: -33, Lng: 151}, "", "", ""},
+	}
+
+	for _, tc := range testcases {
+		p.setPilot(vatsimapi.Pilot{Callsign: "DLH1", Latitude: tc.pos.Lat, Longitude: tc.pos.Lng})
+		pilot, _ := p.GetPilot("DLH1")
+		if pilot.FIRID != tc.fir || pilot.UIRID != tc.uir || pilot.Country != tc.country {
+			t.Errorf("%s: expected fir '%s', uir '%s', country '%s', got '%s', '%s', '%s'",
+				tc.name, tc.fir, tc.uir, tc.country, pilot.FIRID, pilot.UIRID, pilot.Country)
+		}
+	}
+}
+
+func TestFIRContainsPrefilter(t *testing.T) {
+	fir := makeTestFIR("EDWW", rectPoly(50, 5, 56, 15))
+	// the polygon contains the point but the bounding box doesn't
+	fir.Boundaries.Max.Lat = 52
+	if firContains(fir, vatspydata.Point{Lat: 54, Lng: 10}) {
+		t.Error("point outside bounding box is expected to be rejected by the prefilter")
+	}
+	if !firContains(fir, vatspydata.Point{Lat: 51, Lng: 10}) {
+		t.Error("point inside bounding box and polygon is expected to be contained")
+	}
+}
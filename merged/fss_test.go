@@ -0,0 +1,71 @@
+package merged
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	vatsimapi "github.com/vatsimnerd/simwatch-providers/vatsim-api"
+	vatspydata "github.com/vatsimnerd/simwatch-providers/vatspy-data"
+)
+
+func TestFSSAndATISFacilities(t *testing.T) {
+	p := New(nil, nil, nil)
+	p.setCountry(vatspydata.Country{Name: "Germany", Prefix: "ED"})
+	p.setFIR(makeTestFIR("EDWW", rectPoly(50, 5, 56, 15)))
+	p.setFIR(makeTestFIR("EDMM", rectPoly(47, 9, 50, 14)))
+	p.setUIR(vatspydata.UIR{ID: "EURM", Name: "Euro Middle", FIRIDs: []string{"EDWW", "EDMM"}})
+	p.setAirport(vatspydata.AirportMeta{ICAO: "EDDH", IATA: "HAM", Name: "Hamburg", FIRID: "EDWW"})
+
+	testcases := []struct {
+		name string
+		ctrl vatsimapi.Controller
+		firs string
+		atis string
+	}{
+		{"fir fss", vatsimapi.Controller{Callsign: "EDWW_FSS", Facility: vatsimapi.FacilityFSS}, "EDWW", ""},
+		{"uir fss", vatsimapi.Controller{Callsign: "EURM_FSS", Facility: vatsimapi.FacilityFSS}, "EDMM,EDWW", ""},
+		// facility 1 on an airport callsign is an fss of the airport fir, not an atis
+		{"fss on airport callsign", vatsimapi.Controller{Callsign: "EDDH_FSS", Facility: vatsimapi.FacilityFSS}, "EDWW", ""},
+		{"atis", vatsimapi.Controller{Callsign: "EDDH_ATIS", Facility: vatsimapi.FacilityATIS}, "", "EDDH_ATIS"},
+	}
+
+	for _, tc := range testcases {
+		p.setController(tc.ctrl)
+
+		fss, err := p.GetFSS(tc.ctrl.Callsign)
+		if tc.firs == "" {
+			if err == nil {
+				t.Errorf("%s: unexpected fss %+v", tc.name, fss)
+			}
+		} else {
+			ids := make([]string, 0, len(fss.FIRs))
+			for id := range fss.FIRs {
+				ids = append(ids, id)
+			}
+			sort.Strings(ids)
+			if firs := strings.Join(ids, ","); err != nil || firs != tc.firs {
+				t.Errorf("%s: expected fss covering [%s], got [%s], error %v", tc.name, tc.firs, firs, err)
+			}
+		}
+		if radar, err := p.GetRadar(tc.ctrl.Callsign); err == nil {
+			t.Errorf("%s: fss is not expected to be a radar %+v", tc.name, radar)
+		}
+
+		arpt, _ := p.GetAirport("EDDH")
+		if atis := strings.Join(arpt.Controllers.ATIS.Callsigns(), ","); atis != tc.atis {
+			t.Errorf("%s: expected airport atis [%s], got [%s]", tc.name, tc.atis, atis)
+		}
+	}
+
+	p.deleteController(vatsimapi.Controller{Callsign: "EDWW_FSS", Facility: vatsimapi.FacilityFSS})
+	if _, err := p.GetFSS("EDWW_FSS"); err != ErrNotFound {
+		t.Errorf("fss is expected to be deleted, got %v", err)
+	}
+	if _, err := p.GetController("EDWW_FSS"); err != ErrNotFound {
+		t.Errorf("fss controller is expected to be deleted, got %v", err)
+	}
+	if len(p.ListFSS()) != 2 {
+		t.Errorf("expected two fss left, got %+v", p.ListFSS())
+	}
+}
@@ -0,0 +1,107 @@
+package merged
+
+import (
+	"math"
+
+	vatspydata "github.com/vatsimnerd/simwatch-providers/vatspy-data"
+)
+
+const (
+	earthRadiusNM = 3440.065
+)
+
+func toRad(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+// distanceNM returns great-circle distance between two points in nautical miles
+func distanceNM(a, b vatspydata.Point) float64 {
+	lat1 := toRad(a.Lat)
+	lat2 := toRad(b.Lat)
+	dLat := lat2 - lat1
+	dLng := toRad(b.Lng - a.Lng)
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusNM * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// normalizeLng brings longitude into [-180, 180) range
+func normalizeLng(lng float64) float64 {
+	lng = math.Mod(lng+180, 360)
+	if lng < 0 {
+		lng += 360
+	}
+	return lng - 180
+}
+
+// pointInPolygon is a classic ray casting test, the polygon is expected not to cross the antimeridian
+func pointInPolygon(pt vatspydata.Point, poly []vatspydata.Point) bool {
+	inside := false
+	n := len(poly)
+	for i, j := 0, n-1; i < n; j, i = i, i+1 {
+		a, b := poly[i], poly[j]
+		if (a.Lat > pt.Lat) != (b.Lat > pt.Lat) &&
+			pt.Lng < (b.Lng-a.Lng)*(pt.Lat-a.Lat)/(b.Lat-a.Lat)+a.Lng {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// unwrapPolygon makes polygon longitudes continuous so a polygon crossing
+// the antimeridian can be tested with pointInPolygon. The first point is
+// kept in [-180, 180) range, the following ones may go beyond it. Polygons
+// encircling a pole can't be unwrapped, false is returned for them.
+func unwrapPolygon(poly []vatspydata.Point) ([]vatspydata.Point, bool) {
+	if len(poly) == 0 {
+		return nil, false
+	}
+	out := make([]vatspydata.Point, len(poly))
+	out[0] = vatspydata.Point{Lat: poly[0].Lat, Lng: normalizeLng(poly[0].Lng)}
+	for i := 1; i < len(poly); i++ {
+		dLng := normalizeLng(poly[i].Lng - poly[i-1].Lng)
+		out[i] = vatspydata.Point{Lat: poly[i].Lat, Lng: out[i-1].Lng + dLng}
+	}
+	closing := out[len(out)-1].Lng + normalizeLng(poly[0].Lng-poly[len(poly)-1].Lng)
+	return out, math.Abs(closing-out[0].Lng) < 1e-9
+}
+
+func shiftPolygon(poly []vatspydata.Point, dLng float64) []vatspydata.Point {
+	out := make([]vatspydata.Point, len(poly))
+	for i, pt := range poly {
+		out[i] = vatspydata.Point{Lat: pt.Lat, Lng: pt.Lng + dLng}
+	}
+	return out
+}
+
+func cross(o, a, b vatspydata.Point) float64 {
+	return (a.Lng-o.Lng)*(b.Lat-o.Lat) - (a.Lat-o.Lat)*(b.Lng-o.Lng)
+}
+
+func segmentsIntersect(a1, a2, b1, b2 vatspydata.Point) bool {
+	d1 := cross(b1, b2, a1)
+	d2 := cross(b1, b2, a2)
+	d3 := cross(a1, a2, b1)
+	d4 := cross(a1, a2, b2)
+	return ((d1 > 0) != (d2 > 0)) && ((d3 > 0) != (d4 > 0))
+}
+
+// polygonsIntersect reports whether two polygons overlap,
+// both are expected to be in the same longitude range
+func polygonsIntersect(a, b []vatspydata.Point) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return false
+	}
+	if pointInPolygon(a[0], b) || pointInPolygon(b[0], a) {
+		return true
+	}
+	for i, j := 0, len(a)-1; i < len(a); j, i = i, i+1 {
+		for k, l := 0, len(b)-1; k < len(b); l, k = k, k+1 {
+			if segmentsIntersect(a[j], a[i], b[l], b[k]) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,182 @@
+package merged
+
+import (
+	vatspydata "github.com/vatsimnerd/simwatch-providers/vatspy-data"
+)
+
+type (
+	FlightPhase string
+
+	phaseInput struct {
+		prev   *Pilot
+		cur    Pilot
+		depPos *vatspydata.Point
+		arrPos *vatspydata.Point
+	}
+)
+
+const (
+	PhaseUnknown   FlightPhase = ""
+	PhasePreflight FlightPhase = "preflight"
+	PhaseTaxiOut   FlightPhase = "taxi_out"
+	PhaseTakeOff   FlightPhase = "takeoff"
+	PhaseClimb     FlightPhase = "climb"
+	PhaseCruise    FlightPhase = "cruise"
+	PhaseDescent   FlightPhase = "descent"
+	PhaseApproach  FlightPhase = "approach"
+	PhaseLanded    FlightPhase = "landed"
+	PhaseTaxiIn    FlightPhase = "taxi_in"
+	PhaseArrived   FlightPhase = "arrived"
+
+	// groundspeed thresholds, knots
+	stationarySpeed = 5
+	taxiSpeed       = 40
+
+	// vertical speed threshold, feet per minute
+	levelFlightRate = 300
+
+	// distance to the airport within which the aircraft
+	// is considered to be at the airport/in its terminal area, nm
+	airportVicinity = 10
+	terminalArea    = 30
+)
+
+func (ph FlightPhase) isAfterLanding() bool {
+	return ph == PhaseLanded || ph == PhaseTaxiIn || ph == PhaseArrived
+}
+
+func (ph FlightPhase) isBeforeTakeOff() bool {
+	return ph == PhaseUnknown || ph == PhasePreflight || ph == PhaseTaxiOut
+}
+
+func (ph FlightPhase) isAirborne() bool {
+	return ph == PhaseTakeOff || ph == PhaseClimb || ph == PhaseCruise ||
+		ph == PhaseDescent || ph == PhaseApproach
+}
+
+func (in phaseInput) distanceTo(pos *vatspydata.Point) (float64, bool) {
+	if pos == nil {
+		return 0, false
+	}
+	return distanceNM(pilotPosition(in.cur), *pos), true
+}
+
+func (in phaseInput) near(pos *vatspydata.Point, radius float64) bool {
+	dist, ok := in.distanceTo(pos)
+	return ok && dist <= radius
+}
+
+// verticalRate returns feet per minute between the two last snapshots
+func (in phaseInput) verticalRate() (float64, bool) {
+	if in.prev == nil {
+		return 0, false
+	}
+	dAlt := float64(in.cur.Altitude - in.prev.Altitude)
+	dt := in.cur.LastUpdated.Sub(in.prev.LastUpdated).Minutes()
+	if dt <= 0 {
+		// no timing information, assume feed's 15 seconds update period
+		dt = 0.25
+	}
+	return dAlt / dt, true
+}
+
+// isNewLeg returns true if the flight plan has been refiled
+// with another departure or arrival airport
+func (in phaseInput) isNewLeg() bool {
+	prev, cur := in.prev.FlightPlan, in.cur.FlightPlan
+	if prev == nil || cur == nil {
+		return prev != cur
+	}
+	return prev.Departure != cur.Departure || prev.Arrival != cur.Arrival
+}
+
+// detectPhase derives the flight phase from two consecutive pilot snapshots
+func detectPhase(in phaseInput) FlightPhase {
+	prevPhase := PhaseUnknown
+	if in.prev != nil {
+		prevPhase = in.prev.Phase
+	}
+
+	nearDep := in.near(in.depPos, airportVicinity)
+	nearArr := in.near(in.arrPos, airportVicinity)
+
+	// a landed aircraft starts over once a new leg is filed or it's seen
+	// on the ground away from its arrival airport
+	if prevPhase.isAfterLanding() && in.cur.Groundspeed < taxiSpeed {
+		awayFromArr := in.arrPos != nil && !nearArr
+		if in.isNewLeg() || awayFromArr {
+			prevPhase = PhasePreflight
+		}
+	}
+	// an aircraft near its arrival airport which has never been seen airborne
+	// is only considered arrived if it's not at the departure airport as well
+	atArrival := nearArr && !nearDep
+
+	gs := in.cur.Groundspeed
+
+	if gs < taxiSpeed {
+		if prevPhase.isAirborne() {
+			return PhaseLanded
+		}
+		afterLanding := prevPhase.isAfterLanding() || (prevPhase == PhaseUnknown && atArrival)
+		if gs < stationarySpeed {
+			if afterLanding {
+				return PhaseArrived
+			}
+			return PhasePreflight
+		}
+		if afterLanding {
+			return PhaseTaxiIn
+		}
+		return PhaseTaxiOut
+	}
+
+	if prevPhase.isBeforeTakeOff() && in.prev != nil {
+		return PhaseTakeOff
+	}
+
+	inTerminalArea := in.near(in.arrPos, terminalArea)
+	rate, known := in.verticalRate()
+	if !known {
+		switch {
+		case in.near(in.depPos, terminalArea):
+			return PhaseClimb
+		case inTerminalArea:
+			return PhaseApproach
+		default:
+			return PhaseCruise
+		}
+	}
+
+	switch {
+	case rate > levelFlightRate:
+		return PhaseClimb
+	case rate < -levelFlightRate:
+		if inTerminalArea {
+			return PhaseApproach
+		}
+		return PhaseDescent
+	}
+
+	// level flight
+	switch prevPhase {
+	case PhaseApproach:
+		return PhaseApproach
+	case PhaseDescent:
+		if inTerminalArea {
+			return PhaseApproach
+		}
+		return PhaseDescent
+	case PhaseTakeOff:
+		return PhaseClimb
+	}
+	return PhaseCruise
+}
+
+// setPilotPhaseUnsafe updates pilot's flight phase, phase changes
+// are published as EventPhaseChanged
+func (p *Provider) setPilotPhaseUnsafe(pilot *Pilot, prev *Pilot) {
+	in := phaseInput{prev: prev, cur: *pilot}
+	in.depPos, in.arrPos = p.flightPlanPositionsUnsafe(pilot)
+	pilot.Phase = detectPhase(in)
+}
@@ -0,0 +1,137 @@
+package merged
+
+import (
+	"testing"
+	"time"
+
+	vatsimapi "github.com/vatsimnerd/simwatch-providers/vatsim-api"
+	vatspydata "github.com/vatsimnerd/simwatch-providers/vatspy-data"
+)
+
+type phaseStep struct {
+	lat float64
+	lng float64
+	alt int
+	gs  int
+	exp FlightPhase
+}
+
+func TestDetectPhase(t *testing.T) {
+	// EGLL -> LFPG
+	dep := vatspydata.Point{Lat: 51.4775, Lng: -0.4614}
+	arr := vatspydata.Point{Lat: 49.0097, Lng: 2.5479}
+
+	steps := []phaseStep{
+		{51.4700, -0.4500, 80, 0, PhasePreflight},
+		{51.4710, -0.4550, 80, 15, PhaseTaxiOut},
+		{51.4770, -0.4800, 80, 140, PhaseTakeOff},
+		{51.4800, -0.5500, 2500, 180, PhaseClimb},
+		{51.0000, 0.5000, 24000, 420, PhaseClimb},
+		{50.5000, 1.0000, 35000, 460, PhaseClimb},
+		{50.2000, 1.3000, 35000, 460, PhaseCruise},
+		{49.9000, 1.6000, 28000, 420, PhaseDescent},
+		{49.2000, 2.3000, 6000, 220, PhaseApproach},
+		{49.0500, 2.4500, 1500, 150, PhaseApproach},
+		{49.0100, 2.5400, 390, 30, PhaseLanded},
+		{49.0095, 2.5450, 390, 15, PhaseTaxiIn},
+		{49.0097, 2.5479, 390, 0, PhaseArrived},
+	}
+
+	var prev *Pilot
+	ts := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i, st := range steps {
+		cur := Pilot{Pilot: vatsimapi.Pilot{
+			Callsign:    "BAW304",
+			Latitude:    st.lat,
+			Longitude:   st.lng,
+			Altitude:    st.alt,
+			Groundspeed: st.gs,
+			LastUpdated: ts.Add(time.Duration(i) * time.Minute),
+		}}
+		cur.Phase = detectPhase(phaseInput{prev: prev, cur: cur, depPos: &dep, arrPos: &arr})
+		if cur.Phase != st.exp {
+			t.Errorf("step %d: expected phase %s, got %s", i, st.exp, cur.Phase)
+		}
+		prev = &cur
+	}
+}
+
+func TestDetectPhaseTwoLegs(t *testing.T) {
+	p := New(nil, nil, nil)
+	p.setAirport(vatspydata.AirportMeta{ICAO: "EGLL", Position: vatspydata.Point{Lat: 51.4775, Lng: -0.4614}})
+	p.setAirport(vatspydata.AirportMeta{ICAO: "LFPG", Position: vatspydata.Point{Lat: 49.0097, Lng: 2.5479}})
+	sub := p.SubscribeEvents(256)
+
+	outbound := &vatsimapi.FlightPlan{Departure: "EGLL", Arrival: "LFPG"}
+	inbound := &vatsimapi.FlightPlan{Departure: "LFPG", Arrival: "EGLL"}
+
+	steps := []struct {
+		phaseStep
+		fp *vatsimapi.FlightPlan
+	}{
+		{phaseStep{51.4700, -0.4500, 80, 0, PhasePreflight}, outbound},
+		{phaseStep{51.4770, -0.4800, 80, 140, PhaseTakeOff}, outbound},
+		{phaseStep{50.2000, 1.3000, 35000, 460, PhaseClimb}, outbound},
+		{phaseStep{49.0500, 2.4500, 1500, 150, PhaseApproach}, outbound},
+		{phaseStep{49.0100, 2.5400, 390, 30, PhaseLanded}, outbound},
+		{phaseStep{49.0097, 2.5479, 390, 0, PhaseArrived}, outbound},
+		// the second leg is filed at the gate
+		{phaseStep{49.0097, 2.5479, 390, 0, PhasePreflight}, inbound},
+		{phaseStep{49.0100, 2.5450, 390, 15, PhaseTaxiOut}, inbound},
+		{phaseStep{49.0150, 2.5200, 390, 140, PhaseTakeOff}, inbound},
+		{phaseStep{49.1000, 2.3000, 5000, 220, PhaseClimb}, inbound},
+	}
+
+	ts := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i, st := range steps {
+		p.setPilot(vatsimapi.Pilot{
+			Callsign:    "BAW304",
+			Latitude:    st.lat,
+			Longitude:   st.lng,
+			Altitude:    st.alt,
+			Groundspeed: st.gs,
+			FlightPlan:  st.fp,
+			LastUpdated: ts.Add(time.Duration(i) * time.Minute),
+		})
+		pilot, _ := p.GetPilot("BAW304")
+		if pilot.Phase != st.exp {
+			t.Errorf("step %d: expected phase %s, got %s", i, st.exp, pilot.Phase)
+		}
+	}
+
+	departed, changed := 0, 0
+	for _, et := range eventTypes(sub) {
+		switch et {
+		case EventPilotDeparted:
+			departed++
+		case EventPhaseChanged:
+			changed++
+		}
+	}
+	if departed != 2 {
+		t.Errorf("expected 2 departures, got %d", departed)
+	}
+	if changed != len(steps)-1 {
+		t.Errorf("expected %d phase changes, got %d", len(steps)-1, changed)
+	}
+}
+
+func TestDetectPhaseAwayFromArrival(t *testing.T) {
+	dep := vatspydata.Point{Lat: 51.4775, Lng: -0.4614}
+	arr := vatspydata.Point{Lat: 49.0097, Lng: 2.5479}
+	fp := &vatsimapi.FlightPlan{Departure: "EGLL", Arrival: "LFPG"}
+
+	// the pilot has been repositioned back to the departure airport
+	// without refiling the flight plan
+	prev := &Pilot{Phase: PhaseArrived, Pilot: vatsimapi.Pilot{FlightPlan: fp}}
+	cur := Pilot{Pilot: vatsimapi.Pilot{Latitude: 51.4700, Longitude: -0.4500, FlightPlan: fp}}
+	if phase := detectPhase(phaseInput{prev: prev, cur: cur, depPos: &dep, arrPos: &arr}); phase != PhasePreflight {
+		t.Errorf("expected phase %s, got %s", PhasePreflight, phase)
+	}
+
+	// no reset while at the arrival airport
+	cur.Latitude, cur.Longitude = arr.Lat, arr.Lng
+	if phase := detectPhase(phaseInput{prev: prev, cur: cur, depPos: &dep, arrPos: &arr}); phase != PhaseArrived {
+		t.Errorf("expected phase %s, got %s", PhaseArrived, phase)
+	}
+}
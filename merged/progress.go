@@ -0,0 +1,124 @@
+package merged
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	vatspydata "github.com/vatsimnerd/simwatch-providers/vatspy-data"
+)
+
+// FlightProgress is computed for pilots with a flight plan. Distances and ETA
+// are nil when the corresponding airport can't be resolved, DepartureResolved
+// and ArrivalResolved flags tell which one is missing.
+type FlightProgress struct {
+	DepartureResolved   bool       `json:"departure_resolved"`
+	ArrivalResolved     bool       `json:"arrival_resolved"`
+	DistanceFlownNM     *float64   `json:"distance_flown_nm"`
+	DistanceRemainingNM *float64   `json:"distance_remaining_nm"`
+	ETA                 *time.Time `json:"eta"`
+}
+
+const (
+	// approximate speed of sound at cruise levels, knots
+	machKnots = 573
+)
+
+func (fp *FlightProgress) Copy() *FlightProgress {
+	if fp == nil {
+		return nil
+	}
+	cp := *fp
+	if fp.DistanceFlownNM != nil {
+		v := *fp.DistanceFlownNM
+		cp.DistanceFlownNM = &v
+	}
+	if fp.DistanceRemainingNM != nil {
+		v := *fp.DistanceRemainingNM
+		cp.DistanceRemainingNM = &v
+	}
+	if fp.ETA != nil {
+		v := *fp.ETA
+		cp.ETA = &v
+	}
+	return &cp
+}
+
+// parseCruiseTas parses flight plan speed in "450", "N0450" or "M082" formats
+func parseCruiseTas(tas string) int {
+	tas = strings.ToUpper(strings.TrimSpace(tas))
+	if tas == "" {
+		return 0
+	}
+
+	if tas[0] == 'M' {
+		mach, err := strconv.ParseFloat(tas[1:], 64)
+		if err != nil {
+			return 0
+		}
+		// M082 is mach in hundredths, i.e. 0.82
+		if !strings.Contains(tas, ".") {
+			mach /= 100
+		}
+		return int(mach * machKnots)
+	}
+
+	tas = strings.TrimPrefix(tas, "N")
+	speed, err := strconv.ParseInt(tas, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return int(speed)
+}
+
+// flightPlanPositionsUnsafe returns departure and arrival airports positions,
+// nil position means no flight plan or unknown airport
+func (p *Provider) flightPlanPositionsUnsafe(pilot *Pilot) (*vatspydata.Point, *vatspydata.Point) {
+	var depPos, arrPos *vatspydata.Point
+	dep, arr := p.resolveFlightPlanUnsafe(pilot)
+	if arpt, found := p.airports[dep]; found {
+		pos := arpt.Meta.Position
+		depPos = &pos
+	}
+	if arpt, found := p.airports[arr]; found {
+		pos := arpt.Meta.Position
+		arrPos = &pos
+	}
+	return depPos, arrPos
+}
+
+func (p *Provider) setPilotProgressUnsafe(pilot *Pilot) {
+	pilot.Progress = nil
+	if pilot.FlightPlan == nil {
+		return
+	}
+
+	depPos, arrPos := p.flightPlanPositionsUnsafe(pilot)
+	pos := pilotPosition(*pilot)
+	progress := &FlightProgress{
+		DepartureResolved: depPos != nil,
+		ArrivalResolved:   arrPos != nil,
+	}
+
+	if depPos != nil {
+		flown := distanceNM(*depPos, pos)
+		progress.DistanceFlownNM = &flown
+	}
+
+	if arrPos != nil {
+		remaining := distanceNM(pos, *arrPos)
+		progress.DistanceRemainingNM = &remaining
+
+		speed := pilot.Groundspeed
+		if speed < taxiSpeed {
+			// on the ground, use the planned cruise speed
+			speed = parseCruiseTas(pilot.FlightPlan.CruiseTas)
+		}
+		if speed > 0 {
+			eta := pilot.LastUpdated.Add(time.Duration(remaining / float64(speed) * float64(time.Hour)))
+			progress.ETA = &eta
+		}
+	}
+
+	pilot.Progress = progress
+}
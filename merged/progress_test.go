@@ -0,0 +1,107 @@
+package merged
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	vatsimapi "github.com/vatsimnerd/simwatch-providers/vatsim-api"
+	vatspydata "github.com/vatsimnerd/simwatch-providers/vatspy-data"
+)
+
+func TestParseCruiseTas(t *testing.T) {
+	testcases := []struct {
+		tas string
+		exp int
+	}{
+		{"450", 450},
+		{"N0450", 450},
+		{"n0450", 450},
+		{" N0450 ", 450},
+		{"M082", 469},
+		{"M120", 687},
+		{"M0.82", 469},
+		{"M.82", 469},
+		{"", 0},
+		{"VFR", 0},
+		{"MACH", 0},
+		{"K0830", 0},
+	}
+	for _, tc := range testcases {
+		if speed := parseCruiseTas(tc.tas); speed != tc.exp {
+			t.Errorf("'%s': expected %d, got %d", tc.tas, tc.exp, speed)
+		}
+	}
+}
+
+func TestFlightProgress(t *testing.T) {
+	p := New(nil, nil, nil)
+	p.setAirport(vatspydata.AirportMeta{ICAO: "EGLL", IATA: "LHR", Position: vatspydata.Point{Lat: 51.4775, Lng: -0.4614}})
+	p.setAirport(vatspydata.AirportMeta{ICAO: "LFPG", IATA: "CDG", Position: vatspydata.Point{Lat: 49.0097, Lng: 2.5479}})
+
+	ts := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+	// half way between EGLL and LFPG
+	mid := vatspydata.Point{Lat: 50.25, Lng: 1.05}
+	total := distanceNM(vatspydata.Point{Lat: 51.4775, Lng: -0.4614}, vatspydata.Point{Lat: 49.0097, Lng: 2.5479})
+
+	testcases := []struct {
+		name      string
+		fp        *vatsimapi.FlightPlan
+		gs        int
+		flown     bool
+		remaining bool
+		eta       time.Duration
+	}{
+		{"no flight plan", nil, 400, false, false, 0},
+		{"both resolved", &vatsimapi.FlightPlan{Departure: "EGLL", Arrival: "LFPG"}, 400, true, true, time.Duration(total / 2 / 400 * float64(time.Hour))},
+		{"iata codes", &vatsimapi.FlightPlan{Departure: "LHR", Arrival: "CDG"}, 400, true, true, time.Duration(total / 2 / 400 * float64(time.Hour))},
+		{"unknown departure", &vatsimapi.FlightPlan{Departure: "ZZZZ", Arrival: "LFPG"}, 400, false, true, time.Duration(total / 2 / 400 * float64(time.Hour))},
+		{"unknown arrival", &vatsimapi.FlightPlan{Departure: "EGLL", Arrival: "ZZZZ"}, 400, true, false, 0},
+		{"on the ground with cruise speed", &vatsimapi.FlightPlan{Departure: "EGLL", Arrival: "LFPG", CruiseTas: "N0450"}, 10, true, true, time.Duration(total / 2 / 450 * float64(time.Hour))},
+		{"on the ground without cruise speed", &vatsimapi.FlightPlan{Departure: "EGLL", Arrival: "LFPG"}, 10, true, true, 0},
+	}
+
+	near := func(v *float64, exp float64) bool {
+		return v != nil && math.Abs(*v-exp) < 1
+	}
+
+	for _, tc := range testcases {
+		p.setPilot(vatsimapi.Pilot{
+			Callsign:    "BAW304",
+			Latitude:    mid.Lat,
+			Longitude:   mid.Lng,
+			Groundspeed: tc.gs,
+			FlightPlan:  tc.fp,
+			LastUpdated: ts,
+		})
+		pilot, _ := p.GetPilot("BAW304")
+		pr := pilot.Progress
+
+		if tc.fp == nil {
+			if pr != nil {
+				t.Errorf("%s: expected no progress, got %+v", tc.name, pr)
+			}
+			continue
+		}
+		if pr == nil {
+			t.Errorf("%s: expected progress", tc.name)
+			continue
+		}
+		if pr.DepartureResolved != tc.flown || pr.ArrivalResolved != tc.remaining {
+			t.Errorf("%s: unexpected resolution flags %+v", tc.name, pr)
+		}
+		if tc.flown != near(pr.DistanceFlownNM, total/2) || (!tc.flown && pr.DistanceFlownNM != nil) {
+			t.Errorf("%s: unexpected distance flown %v", tc.name, pr.DistanceFlownNM)
+		}
+		if tc.remaining != near(pr.DistanceRemainingNM, total/2) || (!tc.remaining && pr.DistanceRemainingNM != nil) {
+			t.Errorf("%s: unexpected distance remaining %v", tc.name, pr.DistanceRemainingNM)
+		}
+		if tc.eta == 0 {
+			if pr.ETA != nil {
+				t.Errorf("%s: expected no eta, got %v", tc.name, pr.ETA)
+			}
+		} else if pr.ETA == nil || math.Abs(pr.ETA.Sub(ts.Add(tc.eta)).Minutes()) > 1 {
+			t.Errorf("%s: expected eta %v, got %v", tc.name, ts.Add(tc.eta), pr.ETA)
+		}
+	}
+}
@@ -1,11 +1,14 @@
 package merged
 
 import (
+	"context"
 	"fmt"
-	"strings"
+	"os"
 	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
+	simwatchproviders "github.com/vatsimnerd/simwatch-providers"
 	"github.com/vatsimnerd/simwatch-providers/ourairports"
 	vatsimapi "github.com/vatsimnerd/simwatch-providers/vatsim-api"
 	vatspydata "github.com/vatsimnerd/simwatch-providers/vatspy-data"
@@ -19,25 +22,43 @@ var (
 
 type Provider struct {
 	*pubsub.Provider
+	events *pubsub.Provider
 
 	apiConfig  *vatsimapi.Config
 	dataConfig *vatspydata.Config
 	oaConfig   *ourairports.Config
+	cfg        *Config
 
-	stop    chan bool
-	stopped bool
+	life    *simwatchproviders.Lifecycle
+	static  *vatspydata.Provider
+	dynamic *vatsimapi.Provider
+	runways *ourairports.Provider
 
 	airports     map[string]Airport
 	radars       map[string]Radar
+	fss          map[string]FSS
+	unresolved   map[string]UnresolvedRadar
+	controllers  map[string]Controller
 	pilots       map[string]Pilot
 	airportsIata map[string]Airport
+	general      *vatsimapi.GeneralInfo
+	// feedTime is the update timestamp of the last general info, it
+	// stamps disconnect events as deleted clients carry no fresh time
+	feedTime time.Time
 
 	countries  map[string]vatspydata.Country
 	firs       map[string]vatspydata.FIR
 	firsPrefix map[string]vatspydata.FIR
 	uirs       map[string]vatspydata.UIR
 
+	pilotsIndex   *spatialIndex
+	airportsIndex *spatialIndex
+	traffic       *trafficIndex
+
 	airportTrace *set.SafeSet[string]
+	aliases      *aliasTable
+	restored     *restoredState
+	degraded     map[string]error
 
 	dataLock sync.RWMutex
 }
@@ -46,17 +67,25 @@ const (
 	ObjectTypeAirport pubsub.ObjectType = 200 + iota
 	ObjectTypeRadar
 	ObjectTypePilot
+	ObjectTypeFSS
+	ObjectTypeController
+	ObjectTypeUnresolvedRadar
+	ObjectTypeEvent
+	ObjectTypeGeneral
 )
 
 var (
-	errNotFound = fmt.Errorf("not found")
+	ErrNotFound = fmt.Errorf("not found")
 )
 
 func New(apiConfig *vatsimapi.Config, dataConfig *vatspydata.Config, oaConfig *ourairports.Config) *Provider {
 	return &Provider{
 		Provider: pubsub.NewProvider(),
-		stop:     make(chan bool),
-		stopped:  false,
+		events:   pubsub.NewProvider(),
+		life:     simwatchproviders.NewLifecycle(),
+		static:   vatspydata.New(dataConfig),
+		dynamic:  vatsimapi.New(apiConfig),
+		runways:  ourairports.New(oaConfig),
 
 		apiConfig:  apiConfig,
 		dataConfig: dataConfig,
@@ -64,6 +93,9 @@ func New(apiConfig *vatsimapi.Config, dataConfig *vatspydata.Config, oaConfig *o
 
 		airports:     make(map[string]Airport),
 		radars:       make(map[string]Radar),
+		fss:          make(map[string]FSS),
+		unresolved:   make(map[string]UnresolvedRadar),
+		controllers:  make(map[string]Controller),
 		pilots:       make(map[string]Pilot),
 		airportsIata: make(map[string]Airport),
 
@@ -72,35 +104,148 @@ func New(apiConfig *vatsimapi.Config, dataConfig *vatspydata.Config, oaConfig *o
 		firsPrefix: make(map[string]vatspydata.FIR),
 		uirs:       make(map[string]vatspydata.UIR),
 
+		pilotsIndex:   newSpatialIndex(),
+		airportsIndex: newSpatialIndex(),
+		traffic:       newTrafficIndex(),
+
 		airportTrace: set.NewSafe[string](),
+		degraded:     make(map[string]error),
 	}
 }
 
-func (p *Provider) Start() error {
-	if p.stopped {
-		log.Fatal("can't start once stopped provider")
-	}
-	go p.loop()
-	return nil
+// SetConfig sets aliases and snapshot configuration,
+// it must be called before Start
+func (p *Provider) SetConfig(cfg *Config) {
+	p.cfg = cfg
+}
+
+// Start runs the provider loop until ctx is done or the provider is
+// stopped. It blocks until the static data is booted or ctx is done.
+// A failed sub-provider puts the provider into a degraded state, see
+// Degraded. The provider keeps running until stopped even if Start
+// returns a sub-provider boot error.
+func (p *Provider) Start(ctx context.Context) error {
+	return p.life.Start(ctx, p.loop)
 }
 
+// Stop stops the provider and its sub-providers and waits for them to finish
 func (p *Provider) Stop() {
-	p.stop <- true
+	p.life.Stop()
+}
+
+// Done returns a channel which is closed once the provider is stopped
+func (p *Provider) Done() <-chan struct{} {
+	return p.life.Done()
+}
+
+func (p *Provider) setDegraded(name string, err error) {
+	log.WithError(err).WithField("provider", name).Error("sub-provider failed to boot, provider is degraded")
+	p.dataLock.Lock()
+	defer p.dataLock.Unlock()
+	p.degraded[name] = err
+}
+
+// Degraded returns boot errors of the failed sub-providers by their names
+func (p *Provider) Degraded() map[string]error {
+	p.dataLock.RLock()
+	defer p.dataLock.RUnlock()
+	errs := make(map[string]error, len(p.degraded))
+	for name, err := range p.degraded {
+		errs[name] = err
+	}
+	return errs
 }
 
-func (p *Provider) loop() {
-	static := vatspydata.New(p.dataConfig)
-	ssub := static.Subscribe(32768)
+// IsDegraded returns true if any sub-provider has failed to boot
+func (p *Provider) IsDegraded() bool {
+	p.dataLock.RLock()
+	defer p.dataLock.RUnlock()
+	return len(p.degraded) > 0
+}
 
-	dynamic := vatsimapi.New(p.apiConfig)
-	dsub := dynamic.Subscribe(32768)
+// startChild starts a sub-provider without blocking the loop as the loop
+// has to consume the sub-provider updates while it's booting
+func startChild(ctx context.Context, start func(context.Context) error) chan error {
+	ch := make(chan error, 1)
+	go func() {
+		ch <- start(ctx)
+	}()
+	return ch
+}
 
-	runways := ourairports.New(p.oaConfig)
-	rsub := runways.Subscribe(32768)
+// discard consumes updates until the channel is closed or done is closed
+func discard(updates <-chan pubsub.Update, done <-chan struct{}) {
+	for {
+		select {
+		case _, ok := <-updates:
+			if !ok {
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+func (p *Provider) loop(ctx context.Context, booted chan<- error) {
+	if err := p.ReloadAliases(); err != nil {
+		booted <- err
+		return
+	}
+	if err := p.RestoreSnapshot(); err != nil {
+		log.WithError(err).Warn("can't restore snapshot, starting from scratch")
+	}
+
+	ssub := p.static.Subscribe(32768)
+	dsub := p.dynamic.Subscribe(32768)
+	rsub := p.runways.Subscribe(32768)
 	dynamicStarted := false
 
-	static.Start()
-	defer static.Stop()
+	// sub-providers get their own context so that they're stopped
+	// in reverse start order rather than all at once when ctx is done
+	childCtx, cancelChildren := context.WithCancel(context.Background())
+	defer cancelChildren()
+
+	var staticBoot, dynamicBoot, runwaysBoot chan error
+
+	// a failed sub-provider closes its subscription
+	supdates := ssub.Updates()
+	dupdates := dsub.Updates()
+	rupdates := rsub.Updates()
+
+	defer func() {
+		// keep consuming updates so that sub-providers never block
+		// on a full subscription while they're being stopped
+		stopped := make(chan struct{})
+		go discard(supdates, stopped)
+		go discard(dupdates, stopped)
+		go discard(rupdates, stopped)
+		defer close(stopped)
+
+		p.runways.Stop()
+		p.dynamic.Stop()
+		p.static.Stop()
+	}()
+
+	var aliasesTick <-chan time.Time
+	var aliasesMod time.Time
+	if p.cfg != nil && p.cfg.AliasesFile != "" && p.cfg.AliasesReloadPeriod > 0 {
+		if st, err := os.Stat(p.cfg.AliasesFile); err == nil {
+			aliasesMod = st.ModTime()
+		}
+		t := time.NewTicker(p.cfg.AliasesReloadPeriod)
+		defer t.Stop()
+		aliasesTick = t.C
+	}
+
+	var snapshotTick <-chan time.Time
+	if p.cfg != nil && p.cfg.SnapshotFile != "" && p.cfg.SnapshotPeriod > 0 {
+		t := time.NewTicker(p.cfg.SnapshotPeriod)
+		defer t.Stop()
+		snapshotTick = t.C
+	}
+
+	staticBoot = startChild(childCtx, p.static.Start)
 
 	p.SetInitialNotifier(func(sub pubsub.Subscription) {
 		// initial notifier may take time and ponentially
@@ -119,6 +264,18 @@ func (p *Provider) loop() {
 			for _, radar := range p.radars {
 				sub.Send(pubsub.Update{UType: pubsub.UpdateTypeSet, OType: ObjectTypeRadar, Obj: radar})
 			}
+			for _, fss := range p.fss {
+				sub.Send(pubsub.Update{UType: pubsub.UpdateTypeSet, OType: ObjectTypeFSS, Obj: fss})
+			}
+			for _, ur := range p.unresolved {
+				sub.Send(pubsub.Update{UType: pubsub.UpdateTypeSet, OType: ObjectTypeUnresolvedRadar, Obj: ur})
+			}
+			for _, ctrl := range p.controllers {
+				sub.Send(pubsub.Update{UType: pubsub.UpdateTypeSet, OType: ObjectTypeController, Obj: ctrl})
+			}
+			if p.general != nil {
+				sub.Send(pubsub.Update{UType: pubsub.UpdateTypeSet, OType: ObjectTypeGeneral, Obj: p.general.Copy()})
+			}
 		}()
 	})
 
@@ -128,7 +285,27 @@ func (p *Provider) loop() {
 loop:
 	for {
 		select {
-		case upd := <-ssub.Updates():
+		case err := <-staticBoot:
+			staticBoot = nil
+			if err != nil {
+				p.setDegraded("vatspy-data", err)
+				booted <- fmt.Errorf("error booting vatspy data provider: %w", err)
+			}
+		case err := <-dynamicBoot:
+			dynamicBoot = nil
+			if err != nil {
+				p.setDegraded("vatsim-api", err)
+			}
+		case err := <-runwaysBoot:
+			runwaysBoot = nil
+			if err != nil {
+				p.setDegraded("ourairports", err)
+			}
+		case upd, ok := <-supdates:
+			if !ok {
+				supdates = nil
+				continue
+			}
 			staticCount++
 			if staticCount%1000 == 0 {
 				log.Debugf("accumulated %d updates from vatspy data provider", staticCount)
@@ -136,15 +313,15 @@ loop:
 
 			switch upd.UType {
 			case pubsub.UpdateTypeFin:
+				p.reconcileStatic()
 				if !dynamicStarted {
 					// static data is ready, starting dynamic
 					p.SetDataReady(true)
+					booted <- nil
 					log.Info("initial static data ready, starting dynamic provider")
-					dynamic.Start()
-					defer dynamic.Stop()
+					dynamicBoot = startChild(childCtx, p.dynamic.Start)
 					log.Info("initial static data ready, starting ourairports provider")
-					runways.Start()
-					defer runways.Stop()
+					runwaysBoot = startChild(childCtx, p.runways.Start)
 					dynamicStarted = true
 				}
 
@@ -212,7 +389,11 @@ loop:
 					p.deleteUIR(uir)
 				}
 			}
-		case upd := <-rsub.Updates():
+		case upd, ok := <-rupdates:
+			if !ok {
+				rupdates = nil
+				continue
+			}
 			runwayCount++
 			if runwayCount%1000 == 0 {
 				log.Debugf("accumulated %d updates from ourairports provider", runwayCount)
@@ -226,13 +407,18 @@ loop:
 				}
 
 			}
-		case upd := <-dsub.Updates():
+		case upd, ok := <-dupdates:
+			if !ok {
+				dupdates = nil
+				continue
+			}
 			dynamicCount++
 			if dynamicCount%1000 == 0 {
 				log.Debugf("accumulated %d updates from vatsim api provider", dynamicCount)
 			}
 			switch upd.UType {
 			case pubsub.UpdateTypeFin:
+				p.reconcileDynamic()
 				p.Fin()
 			case pubsub.UpdateTypeSet:
 				switch upd.OType {
@@ -250,6 +436,13 @@ loop:
 						continue
 					}
 					p.setController(ctrl)
+				case vatsimapi.ObjectTypeGeneral:
+					info, ok := upd.Obj.(vatsimapi.GeneralInfo)
+					if !ok {
+						log.Errorf("object is expected to be GeneralInfo, got %T", upd.Obj)
+						continue
+					}
+					p.setGeneral(info)
 				}
 			case pubsub.UpdateTypeDelete:
 				switch upd.OType {
@@ -269,10 +462,20 @@ loop:
 					p.deleteController(ctrl)
 				}
 			}
-		case <-p.stop:
+		case <-aliasesTick:
+			aliasesMod = p.watchAliases(aliasesMod)
+		case <-snapshotTick:
+			if err := p.SaveSnapshot(); err != nil {
+				log.WithError(err).Error("error saving snapshot")
+			}
+		case <-ctx.Done():
 			break loop
 		}
 	}
+
+	if err := p.SaveSnapshot(); err != nil {
+		log.WithError(err).Error("error saving snapshot")
+	}
 }
 
 func (p *Provider) setCountry(c vatspydata.Country) {
@@ -280,6 +483,7 @@ func (p *Provider) setCountry(c vatspydata.Country) {
 	p.dataLock.Lock()
 	defer p.dataLock.Unlock()
 	p.countries[c.Prefix] = c
+	p.touchUnsafe(vatspydata.ObjectTypeCountry, c.Prefix)
 }
 
 func (p *Provider) deleteCountry(c vatspydata.Country) {
@@ -295,6 +499,7 @@ func (p *Provider) setFIR(f vatspydata.FIR) {
 	defer p.dataLock.Unlock()
 	p.firs[f.ID] = f
 	p.firsPrefix[f.Prefix] = f
+	p.touchUnsafe(vatspydata.ObjectTypeFIR, f.ID)
 }
 
 func (p *Provider) deleteFIR(f vatspydata.FIR) {
@@ -312,6 +517,7 @@ func (p *Provider) setUIR(u vatspydata.UIR) {
 	p.dataLock.Lock()
 	defer p.dataLock.Unlock()
 	p.uirs[u.ID] = u
+	p.touchUnsafe(vatspydata.ObjectTypeUIR, u.ID)
 }
 
 func (p *Provider) deleteUIR(u vatspydata.UIR) {
@@ -332,6 +538,7 @@ func (p *Provider) setAirport(am vatspydata.AirportMeta) {
 	var arpt Airport
 	p.dataLock.Lock()
 	defer p.dataLock.Unlock()
+	p.touchUnsafe(vatspydata.ObjectTypeAirportMeta, am.ICAO)
 
 	if ex, found := p.airports[am.ICAO]; found {
 		if p.airportTrace.Has(am.ICAO) {
@@ -347,9 +554,11 @@ func (p *Provider) setAirport(am vatspydata.AirportMeta) {
 		}
 		arpt = Airport{Meta: am, Runways: make(map[string]*ourairports.Runway)}
 	}
+	arpt.Traffic = p.traffic.traffic(am.ICAO)
 
 	p.airports[arpt.Meta.ICAO] = arpt
 	p.airportsIata[arpt.Meta.IATA] = arpt
+	p.airportsIndex.set(arpt.Meta.ICAO, arpt.Meta.Position)
 	update := pubsub.Update{UType: pubsub.UpdateTypeSet, OType: ObjectTypeAirport, Obj: arpt}
 	if p.airportTrace.Has(am.ICAO) {
 		l.WithField("update", update).Info("update generated")
@@ -374,6 +583,7 @@ func (p *Provider) deleteAirport(am vatspydata.AirportMeta) {
 		}
 		delete(p.airports, ex.Meta.ICAO)
 		delete(p.airportsIata, ex.Meta.IATA)
+		p.airportsIndex.delete(ex.Meta.ICAO)
 		update := pubsub.Update{UType: pubsub.UpdateTypeDelete, OType: ObjectTypeAirport, Obj: ex}
 		if p.airportTrace.Has(am.ICAO) {
 			l.WithField("update", update).Info("update generated")
@@ -382,21 +592,70 @@ func (p *Provider) deleteAirport(am vatspydata.AirportMeta) {
 	}
 }
 
+// detachControllerUnsafe removes an airport controller from the airport
+// it's been attached to if it's resolved to another one now, i.e. once
+// its alias has been re-targeted
+func (p *Provider) detachControllerUnsafe(c vatsimapi.Controller, icao string) {
+	ex, found := p.controllers[c.Callsign]
+	if !found || ex.AirportICAO == "" || ex.AirportICAO == icao {
+		return
+	}
+	arpt, found := p.airports[ex.AirportICAO]
+	if !found {
+		return
+	}
+
+	prevState := arpt.state()
+	arpt.Controllers = arpt.Controllers.withoutController(ex.Controller)
+	if ex.Facility == vatsimapi.FacilityATIS {
+		arpt.setActiveRunways()
+		arpt.setDecodedATIS()
+	}
+	p.airports[arpt.Meta.ICAO] = arpt
+	p.airportsIata[arpt.Meta.IATA] = arpt
+
+	update := pubsub.Update{UType: pubsub.UpdateTypeSet, OType: ObjectTypeAirport, Obj: arpt}
+	p.Notify(update)
+	p.emitAirportEventsUnsafe(prevState, arpt, c.LastUpdated)
+}
+
 func (p *Provider) setController(c vatsimapi.Controller) {
+	p.dataLock.Lock()
+	defer p.dataLock.Unlock()
+	p.touchUnsafe(ObjectTypeController, c.Callsign)
+	p.setControllerUnsafe(c)
+	// only the object the controller has been resolved to is confirmed,
+	// the one restored for another facility is left to reconcile
+	switch c.Facility {
+	case vatsimapi.FacilityRadar:
+		if _, found := p.radars[c.Callsign]; found {
+			p.touchUnsafe(ObjectTypeRadar, c.Callsign)
+		}
+		if _, found := p.unresolved[c.Callsign]; found {
+			p.touchUnsafe(ObjectTypeUnresolvedRadar, c.Callsign)
+		}
+	case vatsimapi.FacilityFSS:
+		if _, found := p.fss[c.Callsign]; found {
+			p.touchUnsafe(ObjectTypeFSS, c.Callsign)
+		}
+	}
+}
+
+func (p *Provider) setControllerUnsafe(c vatsimapi.Controller) {
 	clog := log.WithFields(logrus.Fields{
 		"callsign": c.Callsign,
 		"func":     "setController",
 	})
-	p.dataLock.Lock()
-	defer p.dataLock.Unlock()
 
-	tokens := strings.Split(c.Callsign, "_")
-	prefix := tokens[0]
+	prefix, alias := p.resolveCallsignUnsafe(c.Callsign)
+	if alias != nil {
+		clog = clog.WithField("alias", alias.Pattern)
+	}
 
-	if c.Facility == 0 {
+	if c.Facility == vatsimapi.FacilityObserver {
 		clog.Trace("skipping ctrl with facility=0")
 		return
-	} else if c.Facility >= 1 && c.Facility <= 5 {
+	} else if isAirportFacility(c.Facility) {
 
 		arpt, err := p.findAirportUnsafe(prefix)
 		if err != nil {
@@ -411,6 +670,8 @@ func (p *Provider) setController(c vatsimapi.Controller) {
 		if trace {
 			alog.WithField("arpt", arpt).Info("airport found")
 		}
+		p.detachControllerUnsafe(c, icao)
+		prevState := arpt.state()
 
 		traceLog := alog.Trace
 		if trace {
@@ -419,27 +680,41 @@ func (p *Provider) setController(c vatsimapi.Controller) {
 
 		switch c.Facility {
 		case vatsimapi.FacilityATIS:
-			arpt.Controllers.ATIS = &c
-			c.HumanReadable = fmt.Sprintf("%s ATIS", arpt.Meta.Name)
+			switch atisKind(c.Callsign) {
+			case ATISArrival:
+				c.HumanReadable = fmt.Sprintf("%s Arrival ATIS", arpt.Meta.Name)
+			case ATISDeparture:
+				c.HumanReadable = fmt.Sprintf("%s Departure ATIS", arpt.Meta.Name)
+			default:
+				c.HumanReadable = fmt.Sprintf("%s ATIS", arpt.Meta.Name)
+			}
+			arpt.Controllers = arpt.Controllers.withController(c)
 			arpt.setActiveRunways()
+			arpt.setDecodedATIS()
 			traceLog("atis set")
 		case vatsimapi.FacilityDelivery:
-			arpt.Controllers.Delivery = &c
 			c.HumanReadable = fmt.Sprintf("%s Delivery", arpt.Meta.Name)
+			arpt.Controllers = arpt.Controllers.withController(c)
 			traceLog("delivery set")
 		case vatsimapi.FacilityGround:
-			arpt.Controllers.Ground = &c
 			c.HumanReadable = fmt.Sprintf("%s Ground", arpt.Meta.Name)
+			arpt.Controllers = arpt.Controllers.withController(c)
 			traceLog("ground set")
 		case vatsimapi.FacilityTower:
-			arpt.Controllers.Tower = &c
 			c.HumanReadable = fmt.Sprintf("%s Tower", arpt.Meta.Name)
+			arpt.Controllers = arpt.Controllers.withController(c)
 			traceLog("tower set")
 		case vatsimapi.FacilityApproach:
-			arpt.Controllers.Approach = &c
 			c.HumanReadable = fmt.Sprintf("%s Approach", arpt.Meta.Name)
+			arpt.Controllers = arpt.Controllers.withController(c)
 			traceLog("approach set")
 		}
+		if ex, found := p.controllers[c.Callsign]; found && ex.AirportICAO == icao &&
+			ex.Facility == vatsimapi.FacilityATIS && c.Facility != vatsimapi.FacilityATIS {
+			// the ATIS has been replaced by another facility
+			arpt.setActiveRunways()
+			arpt.setDecodedATIS()
+		}
 
 		p.airports[arpt.Meta.ICAO] = arpt
 		p.airportsIata[arpt.Meta.IATA] = arpt
@@ -450,55 +725,53 @@ func (p *Provider) setController(c vatsimapi.Controller) {
 		}
 
 		p.Notify(update)
+		pos := arpt.Meta.Position
+		p.setControllerObjectUnsafe(Controller{Controller: c, AirportICAO: icao, Position: &pos})
+		p.emitAirportEventsUnsafe(prevState, arpt, c.LastUpdated)
 	} else if c.Facility == vatsimapi.FacilityRadar {
 
-		firs := make(map[string]vatspydata.FIR, 0)
-		var model *vatspydata.FIR
-
 		clog.Trace("searching for firs")
-		fir, err := p.findFIRUnsafe(prefix)
-		if err == nil {
-			firs[fir.ID] = fir
-			model = &fir
-		} else {
-			uir, err := p.findUIRUnsafe(prefix)
-			if err == nil {
-				for _, firID := range uir.FIRIDs {
-					fir, err := p.findFIRUnsafe(firID)
-					if err == nil {
-						firs[fir.ID] = fir
-						if model == nil {
-							model = &fir
-						}
-					} else {
-						clog.WithFields(logrus.Fields{
-							"fir": firID,
-							"uir": uir.ID,
-						}).Warn("can't find FIR provided by UIR")
-					}
-				}
-			}
-		}
-
-		if len(firs) == 0 {
-			clog.Error("can't find FIR or UIR for radar")
+		cov, err := p.findCoverageUnsafe(prefix, clog)
+		if err != nil {
+			clog.Warn("can't find FIR or UIR for radar, publishing as unresolved")
+			p.setUnresolvedRadarUnsafe(UnresolvedRadar{Controller: c, Prefix: prefix})
 			return
 		}
+		p.deleteUnresolvedRadarUnsafe(c.Callsign)
 
 		controlName := "Centre"
 
-		countryPrefix := model.ID[:2]
+		countryPrefix := cov.model.ID[:2]
 		if country, found := p.countries[countryPrefix]; found && country.ControlCustomName != "" {
 			controlName = country.ControlCustomName
 		}
 
-		c.HumanReadable = fmt.Sprintf("%s %s", fir.Name, controlName)
+		c.HumanReadable = fmt.Sprintf("%s %s", cov.name, controlName)
 
-		radar := Radar{Controller: c, FIRs: firs}
+		radar := Radar{Controller: c, FIRs: cov.firs}
 		p.radars[radar.Controller.Callsign] = radar
 
 		update := pubsub.Update{UType: pubsub.UpdateTypeSet, OType: ObjectTypeRadar, Obj: radar}
 		p.Notify(update)
+		p.setControllerObjectUnsafe(Controller{Controller: c, FIRIDs: cov.firIDs(), Bounds: cov.bounds()})
+
+	} else if c.Facility == vatsimapi.FacilityFSS {
+
+		clog.Trace("searching for fss coverage")
+		cov, err := p.findCoverageUnsafe(prefix, clog)
+		if err != nil {
+			clog.Error("can't find FIR or UIR for fss")
+			return
+		}
+
+		c.HumanReadable = fmt.Sprintf("%s Radio", cov.name)
+
+		fss := FSS{Controller: c, FIRs: cov.firs}
+		p.fss[fss.Controller.Callsign] = fss
+
+		update := pubsub.Update{UType: pubsub.UpdateTypeSet, OType: ObjectTypeFSS, Obj: fss}
+		p.Notify(update)
+		p.setControllerObjectUnsafe(Controller{Controller: c, FIRIDs: cov.firIDs(), Bounds: cov.bounds()})
 
 	} else {
 		clog.WithField("facility", c.Facility).Error("invalid facility")
@@ -513,13 +786,19 @@ func (p *Provider) deleteController(c vatsimapi.Controller) {
 	p.dataLock.Lock()
 	defer p.dataLock.Unlock()
 
-	tokens := strings.Split(c.Callsign, "_")
-	prefix := tokens[0]
+	prefix, _ := p.resolveCallsignUnsafe(c.Callsign)
 
-	if c.Facility == 0 {
+	if c.Facility == vatsimapi.FacilityObserver {
 		clog.Trace("skipping ctrl with facility=0")
 		return
-	} else if c.Facility >= 1 && c.Facility <= 5 {
+	} else if isAirportFacility(c.Facility) {
+
+		// the airport the controller has been attached to
+		// is preferred over the one resolved by the callsign
+		if ex, found := p.controllers[c.Callsign]; found && ex.AirportICAO != "" {
+			prefix = ex.AirportICAO
+		}
+		p.deleteControllerObjectUnsafe(c.Callsign)
 
 		arpt, err := p.findAirportUnsafe(prefix)
 		if err != nil {
@@ -535,49 +814,129 @@ func (p *Provider) deleteController(c vatsimapi.Controller) {
 		if trace {
 			traceLog = alog.Info
 		}
+		prevState := arpt.state()
 
 		switch c.Facility {
 		case vatsimapi.FacilityATIS:
-			arpt.Controllers.ATIS = nil
+			arpt.Controllers = arpt.Controllers.withoutController(c)
 			arpt.setActiveRunways()
+			arpt.setDecodedATIS()
 			traceLog("atis removed")
 		case vatsimapi.FacilityDelivery:
-			arpt.Controllers.Delivery = nil
+			arpt.Controllers = arpt.Controllers.withoutController(c)
 			traceLog("delivery removed")
 		case vatsimapi.FacilityGround:
-			arpt.Controllers.Ground = nil
+			arpt.Controllers = arpt.Controllers.withoutController(c)
 			traceLog("ground removed")
 		case vatsimapi.FacilityTower:
-			arpt.Controllers.Tower = nil
+			arpt.Controllers = arpt.Controllers.withoutController(c)
 			traceLog("tower removed")
 		case vatsimapi.FacilityApproach:
-			arpt.Controllers.Approach = nil
+			arpt.Controllers = arpt.Controllers.withoutController(c)
 			traceLog("approach removed")
 		}
-		update := pubsub.Update{UType: pubsub.UpdateTypeDelete, OType: ObjectTypeAirport, Obj: arpt}
+
+		p.airports[arpt.Meta.ICAO] = arpt
+		p.airportsIata[arpt.Meta.IATA] = arpt
+
+		// the airport itself is still there, only its controllers set has changed
+		update := pubsub.Update{UType: pubsub.UpdateTypeSet, OType: ObjectTypeAirport, Obj: arpt}
 		if trace {
 			alog.WithField("update", update).Info("update generated")
 		}
 		p.Notify(update)
+		p.emitAirportEventsUnsafe(prevState, arpt, c.LastUpdated)
 	} else if c.Facility == vatsimapi.FacilityRadar {
+		p.deleteControllerObjectUnsafe(c.Callsign)
+		p.deleteUnresolvedRadarUnsafe(c.Callsign)
 		if radar, found := p.radars[c.Callsign]; found {
 			delete(p.radars, c.Callsign)
 			update := pubsub.Update{UType: pubsub.UpdateTypeDelete, OType: ObjectTypeRadar, Obj: radar}
 			p.Notify(update)
 		}
+	} else if c.Facility == vatsimapi.FacilityFSS {
+		p.deleteControllerObjectUnsafe(c.Callsign)
+		if fss, found := p.fss[c.Callsign]; found {
+			delete(p.fss, c.Callsign)
+			update := pubsub.Update{UType: pubsub.UpdateTypeDelete, OType: ObjectTypeFSS, Obj: fss}
+			p.Notify(update)
+		}
 	} else {
 		clog.WithField("facility", c.Facility).Error("invalid facility")
 	}
 }
 
+func (p *Provider) setUnresolvedRadarUnsafe(ur UnresolvedRadar) {
+	// the radar might have been resolved before an aliases reload
+	if radar, found := p.radars[ur.Controller.Callsign]; found {
+		delete(p.radars, ur.Controller.Callsign)
+		p.Notify(pubsub.Update{UType: pubsub.UpdateTypeDelete, OType: ObjectTypeRadar, Obj: radar})
+	}
+	p.unresolved[ur.Controller.Callsign] = ur
+	p.Notify(pubsub.Update{UType: pubsub.UpdateTypeSet, OType: ObjectTypeUnresolvedRadar, Obj: ur})
+	p.setControllerObjectUnsafe(Controller{Controller: ur.Controller})
+}
+
+func (p *Provider) deleteUnresolvedRadarUnsafe(callsign string) {
+	if ur, found := p.unresolved[callsign]; found {
+		delete(p.unresolved, callsign)
+		p.Notify(pubsub.Update{UType: pubsub.UpdateTypeDelete, OType: ObjectTypeUnresolvedRadar, Obj: ur})
+	}
+}
+
+func (p *Provider) setControllerObjectUnsafe(ctrl Controller) {
+	_, online := p.controllers[ctrl.Callsign]
+	p.controllers[ctrl.Callsign] = ctrl
+	p.Notify(pubsub.Update{UType: pubsub.UpdateTypeSet, OType: ObjectTypeController, Obj: ctrl})
+	if !online {
+		p.emitEvent(Event{
+			Type:        EventControllerOnline,
+			Time:        ctrl.LastUpdated,
+			Callsign:    ctrl.Callsign,
+			AirportICAO: ctrl.AirportICAO,
+			FIRIDs:      ctrl.FIRIDs,
+		})
+	}
+}
+
+func (p *Provider) deleteControllerObjectUnsafe(callsign string) {
+	if ex, found := p.controllers[callsign]; found {
+		delete(p.controllers, callsign)
+		p.Notify(pubsub.Update{UType: pubsub.UpdateTypeDelete, OType: ObjectTypeController, Obj: ex})
+		p.emitEvent(Event{
+			Type:        EventControllerOffline,
+			Time:        p.feedTime,
+			Callsign:    ex.Callsign,
+			AirportICAO: ex.AirportICAO,
+			FIRIDs:      ex.FIRIDs,
+		})
+	}
+}
+
 func (p *Provider) setPilot(vp vatsimapi.Pilot) {
 	p.dataLock.Lock()
 	defer p.dataLock.Unlock()
+	p.touchUnsafe(ObjectTypePilot, vp.Callsign)
+
+	var prev *Pilot
+	if ex, found := p.pilots[vp.Callsign]; found {
+		prev = &ex
+	}
 
 	pilot := makePilot(vp)
+	hint := ""
+	if prev != nil {
+		hint = prev.FIRID
+	}
+	p.setPilotFIRUnsafe(&pilot, hint)
+	p.setPilotPhaseUnsafe(&pilot, prev)
+	p.setPilotProgressUnsafe(&pilot)
 	p.pilots[pilot.Callsign] = pilot
+	p.pilotsIndex.set(pilot.Callsign, pilotPosition(pilot))
 	update := pubsub.Update{UType: pubsub.UpdateTypeSet, OType: ObjectTypePilot, Obj: pilot}
 	p.Notify(update)
+	p.emitPilotEventsUnsafe(prev, pilot)
+	p.updateTrafficUnsafe(prev, &pilot)
 }
 
 func (p *Provider) deletePilot(vp vatsimapi.Pilot) {
@@ -585,9 +944,23 @@ func (p *Provider) deletePilot(vp vatsimapi.Pilot) {
 	defer p.dataLock.Unlock()
 	if ex, found := p.pilots[vp.Callsign]; found {
 		delete(p.pilots, vp.Callsign)
+		p.pilotsIndex.delete(vp.Callsign)
 		update := pubsub.Update{UType: pubsub.UpdateTypeDelete, OType: ObjectTypePilot, Obj: ex}
 		p.Notify(update)
+		p.emitEvent(Event{Type: EventPilotDisconnected, Time: p.feedTime, Callsign: ex.Callsign})
+		p.updateTrafficUnsafe(&ex, nil)
+	}
+}
+
+// setGeneral passes the network general info through as is
+func (p *Provider) setGeneral(info vatsimapi.GeneralInfo) {
+	p.dataLock.Lock()
+	defer p.dataLock.Unlock()
+	p.general = &info
+	if ts, err := info.General.Timestamp(); err == nil && !ts.IsZero() {
+		p.feedTime = ts
 	}
+	p.Notify(pubsub.Update{UType: pubsub.UpdateTypeSet, OType: ObjectTypeGeneral, Obj: info.Copy()})
 }
 
 func (p *Provider) setRunway(rwy ourairports.Runway) {
@@ -613,6 +986,7 @@ func (p *Provider) setRunway(rwy ourairports.Runway) {
 
 	l = l.WithField("arpt", arpt)
 
+	prevState := arpt.state()
 	needActiveRunways := false
 	if ex, found := arpt.Runways[rwy.Ident]; !found || ex.NE(rwy) {
 		if found {
@@ -641,6 +1015,7 @@ func (p *Provider) setRunway(rwy ourairports.Runway) {
 			l.WithField("update", update).Info("update generated")
 		}
 		p.Notify(update)
+		p.emitAirportEventsUnsafe(prevState, arpt, p.feedTime)
 	}
 }
 
@@ -651,7 +1026,7 @@ func (p *Provider) findAirportUnsafe(id string) (Airport, error) {
 	if arpt, found := p.airportsIata[id]; found {
 		return arpt, nil
 	}
-	return Airport{}, errNotFound
+	return Airport{}, ErrNotFound
 }
 
 func (p *Provider) findFIRUnsafe(id string) (vatspydata.FIR, error) {
@@ -661,14 +1036,14 @@ func (p *Provider) findFIRUnsafe(id string) (vatspydata.FIR, error) {
 	if fir, found := p.firsPrefix[id]; found {
 		return fir, nil
 	}
-	return vatspydata.FIR{}, errNotFound
+	return vatspydata.FIR{}, ErrNotFound
 }
 
 func (p *Provider) findUIRUnsafe(id string) (vatspydata.UIR, error) {
 	if uir, found := p.uirs[id]; found {
 		return uir, nil
 	}
-	return vatspydata.UIR{}, errNotFound
+	return vatspydata.UIR{}, ErrNotFound
 }
 
 func (p *Provider) SetAirportTrace(icao string) {
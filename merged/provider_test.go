@@ -0,0 +1,295 @@
+package merged
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	simwatchproviders "github.com/vatsimnerd/simwatch-providers"
+	"github.com/vatsimnerd/simwatch-providers/ourairports"
+	vatsimapi "github.com/vatsimnerd/simwatch-providers/vatsim-api"
+	vatspydata "github.com/vatsimnerd/simwatch-providers/vatspy-data"
+	"github.com/vatsimnerd/util/pubsub"
+)
+
+func drain(sub pubsub.Subscription) []pubsub.Update {
+	updates := make([]pubsub.Update, 0)
+	for {
+		select {
+		case upd := <-sub.Updates():
+			updates = append(updates, upd)
+		default:
+			return updates
+		}
+	}
+}
+
+func TestControllerLogoff(t *testing.T) {
+	p := New(nil, nil, nil)
+	sub := p.Subscribe(64)
+
+	p.setAirport(vatspydata.AirportMeta{ICAO: "EGLL", IATA: "LHR", Name: "Heathrow"})
+	tower := vatsimapi.Controller{Callsign: "EGLL_TWR", Facility: vatsimapi.FacilityTower}
+	ground := vatsimapi.Controller{Callsign: "EGLL_GND", Facility: vatsimapi.FacilityGround}
+	p.setController(tower)
+	p.setController(ground)
+	drain(sub)
+
+	p.deleteController(tower)
+	updates := drain(sub)
+
+	airportSet := false
+	controllerDeleted := false
+	for _, upd := range updates {
+		switch upd.OType {
+		case ObjectTypeAirport:
+			if upd.UType != pubsub.UpdateTypeSet {
+				t.Errorf("expected airport to be set, got update type %v", upd.UType)
+			}
+			arpt := upd.Obj.(Airport)
+			if len(arpt.Controllers.Tower) != 0 || len(arpt.Controllers.Ground) != 1 {
+				t.Errorf("expected ground only, got %+v", arpt.Controllers)
+			}
+			airportSet = true
+		case ObjectTypeController:
+			if upd.UType == pubsub.UpdateTypeDelete && upd.Obj.(Controller).Callsign == "EGLL_TWR" {
+				controllerDeleted = true
+			}
+		}
+	}
+	if !airportSet {
+		t.Error("expected airport set update")
+	}
+	if !controllerDeleted {
+		t.Error("expected EGLL_TWR controller delete update")
+	}
+
+	arpt, err := p.GetAirport("EGLL")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(arpt.Controllers.Tower) != 0 || !arpt.IsControlled() {
+		t.Errorf("expected tower to be removed from the stored airport, got %+v", arpt.Controllers)
+	}
+
+	p.deleteController(ground)
+	arpt, _ = p.GetAirport("LHR")
+	if arpt.IsControlled() {
+		t.Errorf("expected airport to be uncontrolled, got %+v", arpt.Controllers)
+	}
+}
+
+func TestRadarFallback(t *testing.T) {
+	p := New(nil, nil, nil)
+	sub := p.Subscribe(64)
+
+	p.setCountry(vatspydata.Country{Name: "Germany", Prefix: "ED"})
+	p.setFIR(vatspydata.FIR{ID: "EDWW", Name: "Bremen", Prefix: "EDWW"})
+	p.setFIR(vatspydata.FIR{ID: "EDMM", Name: "Munich", Prefix: "EDMM"})
+	p.setAirport(vatspydata.AirportMeta{ICAO: "EDDH", IATA: "HAM", Name: "Hamburg", FIRID: "EDWW"})
+
+	testcases := []struct {
+		callsign string
+		firs     []string
+	}{
+		{"EDDH_CTR", []string{"EDWW"}},
+		{"ED_CTR", []string{"EDMM", "EDWW"}},
+		{"EDMMN_CTR", []string{"EDMM"}},
+	}
+
+	for _, tc := range testcases {
+		p.setController(vatsimapi.Controller{Callsign: tc.callsign, Facility: vatsimapi.FacilityRadar})
+		radar, err := p.GetRadar(tc.callsign)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.callsign, err)
+			continue
+		}
+		if len(radar.FIRs) != len(tc.firs) {
+			t.Errorf("%s: expected firs %v, got %v", tc.callsign, tc.firs, radar.FIRs)
+		}
+		for _, id := range tc.firs {
+			if _, found := radar.FIRs[id]; !found {
+				t.Errorf("%s: expected fir %s in %v", tc.callsign, id, radar.FIRs)
+			}
+		}
+	}
+	drain(sub)
+
+	unknown := vatsimapi.Controller{Callsign: "XX_CTR", Facility: vatsimapi.FacilityRadar}
+	p.setController(unknown)
+	updates := drain(sub)
+	published := false
+	for _, upd := range updates {
+		if upd.OType == ObjectTypeUnresolvedRadar && upd.UType == pubsub.UpdateTypeSet {
+			published = true
+		}
+	}
+	if !published {
+		t.Error("expected unresolved radar to be published")
+	}
+	if len(p.ListUnresolvedRadars()) != 1 {
+		t.Errorf("expected one unresolved radar, got %v", p.ListUnresolvedRadars())
+	}
+
+	p.deleteController(unknown)
+	if len(p.ListUnresolvedRadars()) != 0 {
+		t.Errorf("expected no unresolved radars, got %v", p.ListUnresolvedRadars())
+	}
+
+	// a country without prefix in the vatspy data
+	p.setCountry(vatspydata.Country{Name: "Nowhere"})
+	p.setController(vatsimapi.Controller{Callsign: "_CTR", Facility: vatsimapi.FacilityRadar})
+	if radar, err := p.GetRadar("_CTR"); err == nil {
+		t.Errorf("expected radar without prefix to be unresolved, got firs %v", radar.FIRs)
+	}
+}
+
+func TestStartDegraded(t *testing.T) {
+	dataConfig := &vatspydata.Config{
+		DataURL:       "mem://missing-data",
+		BoundariesURL: "mem://missing-boundaries",
+	}
+	p := New(nil, dataConfig, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := p.Start(ctx)
+	if err == nil {
+		t.Fatal("start is expected to fail with unreachable static data")
+	}
+	if !p.IsDegraded() {
+		t.Error("provider is expected to be degraded")
+	}
+	if _, found := p.Degraded()["vatspy-data"]; !found {
+		t.Errorf("vatspy-data boot error is expected, got %v", p.Degraded())
+	}
+
+	st := p.Status()
+	if st.State != simwatchproviders.StateDegraded {
+		t.Errorf("expected %s state, got %s", simwatchproviders.StateDegraded, st.State)
+	}
+	if !strings.HasPrefix(st.LastError, "vatspy-data: ") {
+		t.Errorf("expected vatspy-data error, got '%s'", st.LastError)
+	}
+	if st.Children[0].State != simwatchproviders.StateStopped || st.Children[0].ConsecutiveFailures == 0 {
+		t.Errorf("vatspy-data is expected to be stopped after failures, got %+v", st.Children[0])
+	}
+	p.Stop()
+}
+
+func isDone(done <-chan struct{}) bool {
+	select {
+	case <-done:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestStartStopOrder(t *testing.T) {
+	simwatchproviders.SetMemSource("order-data", []byte("[Countries]\nUnited Kingdom|EG|\n[Airports]\nEGLL|Heathrow|51.4775|-0.4614|LHR|EGTT|0\n"))
+	simwatchproviders.SetMemSource("order-boundaries", []byte(`{"type":"FeatureCollection","features":[]}`))
+	simwatchproviders.SetMemSource("order-feed", []byte(`{}`))
+	simwatchproviders.SetMemSource("order-runways", []byte(""))
+	defer func() {
+		for _, name := range []string{"order-data", "order-boundaries", "order-feed", "order-runways"} {
+			simwatchproviders.DeleteMemSource(name)
+		}
+	}()
+
+	poll := simwatchproviders.PollConfig{Period: time.Hour}
+	p := New(
+		&vatsimapi.Config{URL: "mem://order-feed", Poll: poll},
+		&vatspydata.Config{DataURL: "mem://order-data", BoundariesURL: "mem://order-boundaries", Poll: poll},
+		&ourairports.Config{URL: "mem://order-runways", Poll: poll},
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := p.Start(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := p.GetAirport("EGLL"); err != nil {
+		t.Errorf("static data is expected to be loaded once started, got %v", err)
+	}
+	if err := p.Start(ctx); err == nil {
+		t.Error("second start is expected to fail")
+	}
+
+	st := p.Status()
+	if st.State != simwatchproviders.StateReady || !st.Ready() {
+		t.Errorf("expected %s state, got %s", simwatchproviders.StateReady, st.State)
+	}
+	if st.Objects["airports"] != 1 || st.Children[0].Objects["airports"] != 1 {
+		t.Errorf("expected 1 airport, got %v", st.Objects)
+	}
+
+	// static data is started first and must be stopped last
+	staticLast := make(chan bool, 1)
+	go func() {
+		<-p.static.Done()
+		staticLast <- isDone(p.dynamic.Done()) && isDone(p.runways.Done())
+	}()
+
+	p.Stop()
+	for name, done := range map[string]<-chan struct{}{
+		"merged":      p.Done(),
+		"vatspy-data": p.static.Done(),
+		"vatsim-api":  p.dynamic.Done(),
+		"ourairports": p.runways.Done(),
+	} {
+		if !isDone(done) {
+			t.Errorf("%s is expected to be done after stop", name)
+		}
+	}
+	if !<-staticLast {
+		t.Error("static provider is expected to be stopped after dynamic and runways")
+	}
+
+	if st := p.Status(); st.Alive() {
+		t.Errorf("provider is expected to be stopped, got %s", st.State)
+	}
+
+	// stop is idempotent
+	p.Stop()
+	if err := p.Start(ctx); err == nil {
+		t.Error("start is expected to fail once stopped")
+	}
+}
+
+func TestStopNotStarted(t *testing.T) {
+	p := New(nil, nil, nil)
+	p.Stop()
+	p.Stop()
+	if !isDone(p.Done()) {
+		t.Error("provider is expected to be done after stop")
+	}
+}
+
+func TestGeneralInfoPassThrough(t *testing.T) {
+	p := New(nil, nil, nil)
+	sub := p.Subscribe(16)
+
+	if _, err := p.GetGeneralInfo(); err != ErrNotFound {
+		t.Errorf("expected %v, got %v", ErrNotFound, err)
+	}
+
+	info := vatsimapi.GeneralInfo{
+		General:  vatsimapi.General{ConnectedClients: 42},
+		Counters: vatsimapi.Counters{Pilots: 40, ControllersByFacility: map[vatsimapi.Facility]int{vatsimapi.FacilityTower: 2}},
+	}
+	p.setGeneral(info)
+
+	got, err := p.GetGeneralInfo()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.General.ConnectedClients != 42 || got.Counters.ControllersByFacility[vatsimapi.FacilityTower] != 2 {
+		t.Errorf("unexpected general info %+v", got)
+	}
+	updates := drain(sub)
+	if len(updates) != 1 || updates[0].OType != ObjectTypeGeneral {
+		t.Errorf("expected a single general info update, got %v", updates)
+	}
+}
@@ -0,0 +1,177 @@
+package merged
+
+import (
+	vatsimapi "github.com/vatsimnerd/simwatch-providers/vatsim-api"
+	vatspydata "github.com/vatsimnerd/simwatch-providers/vatspy-data"
+)
+
+// AirportFilter narrows down the result of ListAirports.
+// Zero value matches every airport.
+type AirportFilter struct {
+	ControlledOnly bool
+	FIRID          string
+	ExcludePseudo  bool
+}
+
+func (f AirportFilter) match(a Airport) bool {
+	if f.ControlledOnly && !a.IsControlled() {
+		return false
+	}
+	if f.FIRID != "" && a.Meta.FIRID != f.FIRID {
+		return false
+	}
+	if f.ExcludePseudo && a.Meta.IsPseudo {
+		return false
+	}
+	return true
+}
+
+// GetAirport looks up an airport by its ICAO or IATA code
+func (p *Provider) GetAirport(id string) (Airport, error) {
+	p.dataLock.RLock()
+	defer p.dataLock.RUnlock()
+	arpt, err := p.findAirportUnsafe(id)
+	if err != nil {
+		return Airport{}, err
+	}
+	return arpt.Copy(), nil
+}
+
+func (p *Provider) ListAirports(filter AirportFilter) []Airport {
+	p.dataLock.RLock()
+	defer p.dataLock.RUnlock()
+	airports := make([]Airport, 0)
+	for _, arpt := range p.airports {
+		if filter.match(arpt) {
+			airports = append(airports, arpt.Copy())
+		}
+	}
+	return airports
+}
+
+func (p *Provider) GetPilot(callsign string) (Pilot, error) {
+	p.dataLock.RLock()
+	defer p.dataLock.RUnlock()
+	if pilot, found := p.pilots[callsign]; found {
+		return pilot.Copy(), nil
+	}
+	return Pilot{}, ErrNotFound
+}
+
+func (p *Provider) ListPilots() []Pilot {
+	p.dataLock.RLock()
+	defer p.dataLock.RUnlock()
+	pilots := make([]Pilot, 0, len(p.pilots))
+	for _, pilot := range p.pilots {
+		pilots = append(pilots, pilot.Copy())
+	}
+	return pilots
+}
+
+func (p *Provider) GetRadar(callsign string) (Radar, error) {
+	p.dataLock.RLock()
+	defer p.dataLock.RUnlock()
+	if radar, found := p.radars[callsign]; found {
+		return radar.Copy(), nil
+	}
+	return Radar{}, ErrNotFound
+}
+
+func (p *Provider) ListRadars() []Radar {
+	p.dataLock.RLock()
+	defer p.dataLock.RUnlock()
+	radars := make([]Radar, 0, len(p.radars))
+	for _, radar := range p.radars {
+		radars = append(radars, radar.Copy())
+	}
+	return radars
+}
+
+func (p *Provider) ListUnresolvedRadars() []UnresolvedRadar {
+	p.dataLock.RLock()
+	defer p.dataLock.RUnlock()
+	radars := make([]UnresolvedRadar, 0, len(p.unresolved))
+	for _, ur := range p.unresolved {
+		radars = append(radars, ur.Copy())
+	}
+	return radars
+}
+
+// GetFIR looks up a FIR by its ID or callsign prefix
+func (p *Provider) GetFIR(id string) (vatspydata.FIR, error) {
+	p.dataLock.RLock()
+	defer p.dataLock.RUnlock()
+	fir, err := p.findFIRUnsafe(id)
+	if err != nil {
+		return vatspydata.FIR{}, err
+	}
+	return fir.Copy(), nil
+}
+
+func (p *Provider) GetUIR(id string) (vatspydata.UIR, error) {
+	p.dataLock.RLock()
+	defer p.dataLock.RUnlock()
+	uir, err := p.findUIRUnsafe(id)
+	if err != nil {
+		return vatspydata.UIR{}, err
+	}
+	return uir.Copy(), nil
+}
+
+func (p *Provider) GetCountry(prefix string) (vatspydata.Country, error) {
+	p.dataLock.RLock()
+	defer p.dataLock.RUnlock()
+	if country, found := p.countries[prefix]; found {
+		return country, nil
+	}
+	return vatspydata.Country{}, ErrNotFound
+}
+
+func (p *Provider) GetFSS(callsign string) (FSS, error) {
+	p.dataLock.RLock()
+	defer p.dataLock.RUnlock()
+	if fss, found := p.fss[callsign]; found {
+		return fss.Copy(), nil
+	}
+	return FSS{}, ErrNotFound
+}
+
+func (p *Provider) ListFSS() []FSS {
+	p.dataLock.RLock()
+	defer p.dataLock.RUnlock()
+	fss := make([]FSS, 0, len(p.fss))
+	for _, f := range p.fss {
+		fss = append(fss, f.Copy())
+	}
+	return fss
+}
+
+func (p *Provider) GetController(callsign string) (Controller, error) {
+	p.dataLock.RLock()
+	defer p.dataLock.RUnlock()
+	if ctrl, found := p.controllers[callsign]; found {
+		return ctrl.Copy(), nil
+	}
+	return Controller{}, ErrNotFound
+}
+
+func (p *Provider) ListControllers() []Controller {
+	p.dataLock.RLock()
+	defer p.dataLock.RUnlock()
+	controllers := make([]Controller, 0, len(p.controllers))
+	for _, ctrl := range p.controllers {
+		controllers = append(controllers, ctrl.Copy())
+	}
+	return controllers
+}
+
+// GetGeneralInfo returns the network general info and counters
+// of the last applied VATSIM feed payload
+func (p *Provider) GetGeneralInfo() (vatsimapi.GeneralInfo, error) {
+	p.dataLock.RLock()
+	defer p.dataLock.RUnlock()
+	if p.general == nil {
+		return vatsimapi.GeneralInfo{}, ErrNotFound
+	}
+	return p.general.Copy(), nil
+}
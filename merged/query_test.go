@@ -0,0 +1,161 @@
+package merged
+
+import (
+	"testing"
+
+	"github.com/vatsimnerd/simwatch-providers/ourairports"
+	vatsimapi "github.com/vatsimnerd/simwatch-providers/vatsim-api"
+	vatspydata "github.com/vatsimnerd/simwatch-providers/vatspy-data"
+)
+
+func TestQueryReturnsCopies(t *testing.T) {
+	p := New(nil, nil, nil)
+
+	bdrs := vatspydata.Boundaries{Points: [][]vatspydata.Point{{{Lat: 53, Lng: 8}, {Lat: 54, Lng: 10}, {Lat: 53, Lng: 10}}}}
+	p.setFIR(vatspydata.FIR{ID: "EDWW", Name: "Bremen", Prefix: "EDWW", Boundaries: bdrs})
+	p.setUIR(vatspydata.UIR{ID: "EURW", Name: "Europe West", FIRIDs: []string{"EDWW"}})
+	p.setAirport(vatspydata.AirportMeta{ICAO: "EDDH", IATA: "HAM", Name: "Hamburg", FIRID: "EDWW"})
+	p.setRunway(ourairports.Runway{ICAO: "EDDH", Ident: "23"})
+	p.setController(vatsimapi.Controller{Callsign: "EDDH_TWR", Facility: vatsimapi.FacilityTower})
+	p.setController(vatsimapi.Controller{Callsign: "EDWW_CTR", Facility: vatsimapi.FacilityRadar})
+	p.setController(vatsimapi.Controller{Callsign: "EDWW_FSS", Facility: vatsimapi.FacilityFSS})
+	p.setPilot(vatsimapi.Pilot{Callsign: "DLH1", FlightPlan: &vatsimapi.FlightPlan{Departure: "EDDH", Arrival: "EDDM"}})
+	p.setGeneral(vatsimapi.GeneralInfo{
+		Counters: vatsimapi.Counters{ControllersByFacility: map[vatsimapi.Facility]int{vatsimapi.FacilityTower: 1}},
+	})
+
+	testcases := []struct {
+		name   string
+		mutate func()
+		intact func() bool
+	}{
+		{
+			"GetAirport controllers",
+			func() {
+				arpt, _ := p.GetAirport("EDDH")
+				delete(arpt.Controllers.Tower, "EDDH_TWR")
+			},
+			func() bool {
+				arpt, _ := p.GetAirport("EDDH")
+				return len(arpt.Controllers.Tower) == 1
+			},
+		},
+		{
+			"GetAirport runways",
+			func() {
+				arpt, _ := p.GetAirport("HAM")
+				arpt.Runways["23"].ActiveTO = true
+			},
+			func() bool {
+				arpt, _ := p.GetAirport("HAM")
+				return !arpt.Runways["23"].ActiveTO
+			},
+		},
+		{
+			"ListAirports controllers",
+			func() {
+				p.ListAirports(AirportFilter{})[0].Controllers.Tower["EDDH_X_TWR"] = vatsimapi.Controller{}
+			},
+			func() bool {
+				return len(p.ListAirports(AirportFilter{})[0].Controllers.Tower) == 1
+			},
+		},
+		{
+			"GetPilot flight plan",
+			func() {
+				pilot, _ := p.GetPilot("DLH1")
+				pilot.FlightPlan.Arrival = "EGLL"
+			},
+			func() bool {
+				pilot, _ := p.GetPilot("DLH1")
+				return pilot.FlightPlan.Arrival == "EDDM"
+			},
+		},
+		{
+			"ListPilots flight plan",
+			func() { p.ListPilots()[0].FlightPlan.Arrival = "EGLL" },
+			func() bool { return p.ListPilots()[0].FlightPlan.Arrival == "EDDM" },
+		},
+		{
+			"GetRadar firs",
+			func() {
+				radar, _ := p.GetRadar("EDWW_CTR")
+				delete(radar.FIRs, "EDWW")
+			},
+			func() bool {
+				radar, _ := p.GetRadar("EDWW_CTR")
+				return len(radar.FIRs) == 1
+			},
+		},
+		{
+			"ListRadars fir boundaries",
+			func() { p.ListRadars()[0].FIRs["EDWW"].Boundaries.Points[0][0].Lat = 0 },
+			func() bool { return p.ListRadars()[0].FIRs["EDWW"].Boundaries.Points[0][0].Lat == 53 },
+		},
+		{
+			"GetFSS firs",
+			func() {
+				fss, _ := p.GetFSS("EDWW_FSS")
+				delete(fss.FIRs, "EDWW")
+			},
+			func() bool {
+				fss, _ := p.GetFSS("EDWW_FSS")
+				return len(fss.FIRs) == 1
+			},
+		},
+		{
+			"GetController fir ids",
+			func() {
+				ctrl, _ := p.GetController("EDWW_CTR")
+				ctrl.FIRIDs[0] = "XXXX"
+			},
+			func() bool {
+				ctrl, _ := p.GetController("EDWW_CTR")
+				return ctrl.FIRIDs[0] == "EDWW"
+			},
+		},
+		{
+			"GetFIR boundaries",
+			func() {
+				fir, _ := p.GetFIR("EDWW")
+				fir.Boundaries.Points[0][0].Lat = 0
+			},
+			func() bool {
+				fir, _ := p.GetFIR("EDWW")
+				return fir.Boundaries.Points[0][0].Lat == 53
+			},
+		},
+		{
+			"GetUIR fir ids",
+			func() {
+				uir, _ := p.GetUIR("EURW")
+				uir.FIRIDs[0] = "XXXX"
+			},
+			func() bool {
+				uir, _ := p.GetUIR("EURW")
+				return uir.FIRIDs[0] == "EDWW"
+			},
+		},
+		{
+			"GetGeneralInfo counters",
+			func() {
+				info, _ := p.GetGeneralInfo()
+				info.Counters.ControllersByFacility[vatsimapi.FacilityTower] = 100
+			},
+			func() bool {
+				info, _ := p.GetGeneralInfo()
+				return info.Counters.ControllersByFacility[vatsimapi.FacilityTower] == 1
+			},
+		},
+	}
+
+	for _, tc := range testcases {
+		if !tc.intact() {
+			t.Fatalf("%s: unexpected initial state", tc.name)
+		}
+		tc.mutate()
+		if !tc.intact() {
+			t.Errorf("%s: stored object is modified through the returned one", tc.name)
+		}
+	}
+}
@@ -76,10 +76,10 @@ func normalizeAtisText(text string, collapseNumbers bool) string {
 	return strings.TrimSpace(text)
 }
 
-func detectArrivalRunways(atisText string) *set.Set[string] {
+func matchRunways(atisText string, expressions []*regexp.Regexp) *set.Set[string] {
 	results := set.New[string]()
 	if atisText != "" {
-		for _, re := range arrivalExpressions {
+		for _, re := range expressions {
 			match := re.FindAllStringSubmatch(atisText, -1)
 			if len(match) > 0 {
 				for _, m := range match[0][1:] {
@@ -94,50 +94,39 @@ func detectArrivalRunways(atisText string) *set.Set[string] {
 	return results
 }
 
-func detectDepartureRunways(atisText string) *set.Set[string] {
-	results := set.New[string]()
-	if atisText != "" {
-		for _, re := range departureExpressions {
-			match := re.FindAllStringSubmatch(atisText, -1)
-			if len(match) > 0 {
-				for _, m := range match[0][1:] {
-					if m != "" {
-						results.Add(normalizeIdent(m))
-					}
-				}
-				return results
-			}
-		}
+// detectRunways normalizes ATIS text and matches it against expressions,
+// falling back to the text with spoken-style numbers collapsed
+func detectRunways(atisText string, expressions []*regexp.Regexp) *set.Set[string] {
+	text := normalizeAtisText(atisText, false)
+	runways := matchRunways(text, expressions)
+	if runways.Size() == 0 {
+		collapsed := normalizeAtisText(text, true)
+		runways = matchRunways(collapsed, expressions)
 	}
-	return results
+	return runways
 }
 
-func (a *Airport) setActiveRunways() {
-	if a.Controllers.ATIS == nil {
-		for _, rwy := range a.Runways {
-			rwy.ActiveLnd = false
-			rwy.ActiveTO = false
-		}
-		return
-	}
+func detectArrivalRunways(atisText string) *set.Set[string] {
+	return detectRunways(atisText, arrivalExpressions)
+}
 
-	atisText := normalizeAtisText(a.Controllers.ATIS.TextAtis, false)
+func detectDepartureRunways(atisText string) *set.Set[string] {
+	return detectRunways(atisText, departureExpressions)
+}
 
-	runways := detectArrivalRunways(atisText)
-	if runways.Size() == 0 {
-		collapsed := normalizeAtisText(atisText, true)
-		runways = detectArrivalRunways(collapsed)
-	}
-	for ident, rwy := range a.Runways {
-		rwy.ActiveLnd = runways.Has(ident)
+func (a *Airport) setActiveRunways() {
+	landing := set.New[string]()
+	if atis := a.Controllers.ArrivalATIS(); atis != nil {
+		landing = detectArrivalRunways(atis.TextAtis)
 	}
 
-	runways = detectDepartureRunways(atisText)
-	if runways.Size() == 0 {
-		collapsed := normalizeAtisText(atisText, true)
-		runways = detectDepartureRunways(collapsed)
+	takeoff := set.New[string]()
+	if atis := a.Controllers.DepartureATIS(); atis != nil {
+		takeoff = detectDepartureRunways(atis.TextAtis)
 	}
+
 	for ident, rwy := range a.Runways {
-		rwy.ActiveTO = runways.Has(ident)
+		rwy.ActiveLnd = landing.Has(ident)
+		rwy.ActiveTO = takeoff.Has(ident)
 	}
 }
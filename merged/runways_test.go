@@ -4,6 +4,8 @@ import (
 	"regexp"
 	"testing"
 
+	"github.com/vatsimnerd/simwatch-providers/ourairports"
+	vatsimapi "github.com/vatsimnerd/simwatch-providers/vatsim-api"
 	"github.com/vatsimnerd/util/set"
 )
 
@@ -140,3 +142,70 @@ func TestDetectRunways(t *testing.T) {
 		}
 	}
 }
+
+func TestSeparateATIS(t *testing.T) {
+	arrival := vatsimapi.Controller{
+		Callsign: "KJFK_A_ATIS",
+		Facility: vatsimapi.FacilityATIS,
+		TextAtis: "KENNEDY ARRIVAL INFORMATION B. EXPECT ILS APPROACH. LANDING RUNWAY 22L. DEPARTURE RUNWAY 31L.",
+	}
+	departure := vatsimapi.Controller{
+		Callsign: "KJFK_D_ATIS",
+		Facility: vatsimapi.FacilityATIS,
+		TextAtis: "KENNEDY DEPARTURE INFORMATION C. DEPARTURE RUNWAY 31L.",
+	}
+
+	arpt := Airport{Runways: map[string]*ourairports.Runway{
+		"22L": {Ident: "22L"},
+		"31L": {Ident: "31L"},
+	}}
+
+	arpt.Controllers = arpt.Controllers.withController(arrival)
+	arpt.setActiveRunways()
+	if !arpt.Runways["22L"].ActiveLnd || arpt.Runways["31L"].ActiveLnd {
+		t.Errorf("expected 22L to be the only landing runway")
+	}
+	// arrival ATIS is never used for departures, even if it's the only one
+	if arpt.Runways["22L"].ActiveTO || arpt.Runways["31L"].ActiveTO {
+		t.Errorf("expected no takeoff runways detected from arrival ATIS")
+	}
+
+	arpt.Controllers = arpt.Controllers.withController(departure)
+	arpt.setActiveRunways()
+	if !arpt.Runways["22L"].ActiveLnd || arpt.Runways["31L"].ActiveLnd {
+		t.Errorf("expected 22L to be the only landing runway")
+	}
+	if !arpt.Runways["31L"].ActiveTO || arpt.Runways["22L"].ActiveTO {
+		t.Errorf("expected 31L to be the only takeoff runway")
+	}
+
+	arpt.Controllers = arpt.Controllers.withoutController(arrival)
+	arpt.setActiveRunways()
+	if arpt.Runways["22L"].ActiveLnd || arpt.Runways["31L"].ActiveLnd {
+		t.Errorf("expected no landing runways detected from departure ATIS")
+	}
+	if !arpt.Runways["31L"].ActiveTO {
+		t.Errorf("expected 31L to be the takeoff runway")
+	}
+
+	combined := vatsimapi.Controller{
+		Callsign: "KJFK_ATIS",
+		Facility: vatsimapi.FacilityATIS,
+		TextAtis: "KENNEDY INFORMATION D. LANDING RUNWAY 31L. DEPARTURE RUNWAY 22L.",
+	}
+	arpt.Controllers = arpt.Controllers.withController(combined)
+	arpt.setActiveRunways()
+	// combined ATIS fills in the arrival role only, departure ATIS is preferred
+	if !arpt.Runways["31L"].ActiveLnd || arpt.Runways["22L"].ActiveLnd {
+		t.Errorf("expected 31L to be the only landing runway")
+	}
+	if !arpt.Runways["31L"].ActiveTO || arpt.Runways["22L"].ActiveTO {
+		t.Errorf("expected 31L to be the only takeoff runway")
+	}
+
+	arpt.Controllers = arpt.Controllers.withoutController(departure)
+	arpt.setActiveRunways()
+	if !arpt.Runways["22L"].ActiveTO || arpt.Runways["31L"].ActiveTO {
+		t.Errorf("expected 22L to be the only takeoff runway")
+	}
+}
@@ -0,0 +1,361 @@
+package merged
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vatsimnerd/simwatch-providers/ourairports"
+	vatspydata "github.com/vatsimnerd/simwatch-providers/vatspy-data"
+	"github.com/vatsimnerd/util/pubsub"
+	"github.com/vatsimnerd/util/set"
+)
+
+const (
+	SnapshotVersion = 1
+)
+
+type (
+	// snapshot is the full provider state persisted between restarts.
+	// Runways are persisted as a part of airports.
+	snapshot struct {
+		Version     int                  `json:"version"`
+		CreatedAt   time.Time            `json:"created_at"`
+		Countries   []vatspydata.Country `json:"countries"`
+		FIRs        []vatspydata.FIR     `json:"firs"`
+		UIRs        []vatspydata.UIR     `json:"uirs"`
+		Airports    []Airport            `json:"airports"`
+		Pilots      []Pilot              `json:"pilots"`
+		Radars      []Radar              `json:"radars"`
+		FSS         []FSS                `json:"fss"`
+		Unresolved  []UnresolvedRadar    `json:"unresolved_radars"`
+		Controllers []Controller         `json:"controllers"`
+	}
+
+	// restoredState tracks objects restored from a snapshot which
+	// haven't been confirmed by fresh data yet
+	restoredState struct {
+		static         *set.Set[objectKey]
+		dynamic        *set.Set[objectKey]
+		staticPending  bool
+		dynamicPending bool
+	}
+)
+
+func (p *Provider) makeSnapshotUnsafe() snapshot {
+	s := snapshot{
+		Version:     SnapshotVersion,
+		CreatedAt:   time.Now().UTC(),
+		Countries:   make([]vatspydata.Country, 0, len(p.countries)),
+		FIRs:        make([]vatspydata.FIR, 0, len(p.firs)),
+		UIRs:        make([]vatspydata.UIR, 0, len(p.uirs)),
+		Airports:    make([]Airport, 0, len(p.airports)),
+		Pilots:      make([]Pilot, 0, len(p.pilots)),
+		Radars:      make([]Radar, 0, len(p.radars)),
+		FSS:         make([]FSS, 0, len(p.fss)),
+		Unresolved:  make([]UnresolvedRadar, 0, len(p.unresolved)),
+		Controllers: make([]Controller, 0, len(p.controllers)),
+	}
+	for _, c := range p.countries {
+		s.Countries = append(s.Countries, c)
+	}
+	for _, fir := range p.firs {
+		s.FIRs = append(s.FIRs, fir.Copy())
+	}
+	for _, uir := range p.uirs {
+		s.UIRs = append(s.UIRs, uir.Copy())
+	}
+	for _, arpt := range p.airports {
+		s.Airports = append(s.Airports, arpt.Copy())
+	}
+	for _, pilot := range p.pilots {
+		s.Pilots = append(s.Pilots, pilot.Copy())
+	}
+	for _, radar := range p.radars {
+		s.Radars = append(s.Radars, radar.Copy())
+	}
+	for _, fss := range p.fss {
+		s.FSS = append(s.FSS, fss.Copy())
+	}
+	for _, ur := range p.unresolved {
+		s.Unresolved = append(s.Unresolved, ur.Copy())
+	}
+	for _, ctrl := range p.controllers {
+		s.Controllers = append(s.Controllers, ctrl.Copy())
+	}
+	return s
+}
+
+// SaveSnapshot writes the current state to the configured snapshot file
+func (p *Provider) SaveSnapshot() error {
+	if p.cfg == nil || p.cfg.SnapshotFile == "" {
+		return nil
+	}
+
+	p.dataLock.RLock()
+	if len(p.airports) == 0 {
+		// nothing has been loaded yet, keep the previous snapshot
+		p.dataLock.RUnlock()
+		return nil
+	}
+	s := p.makeSnapshotUnsafe()
+	p.dataLock.RUnlock()
+
+	// write to a temporary file first so a crash never leaves a broken snapshot
+	tmpFilename := p.cfg.SnapshotFile + ".tmp"
+	f, err := os.Create(tmpFilename)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFilename)
+
+	zw := gzip.NewWriter(f)
+	err = json.NewEncoder(zw).Encode(s)
+	if err == nil {
+		err = zw.Close()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpFilename, p.cfg.SnapshotFile)
+}
+
+func loadSnapshot(filename string) (snapshot, error) {
+	var s snapshot
+	f, err := os.Open(filename)
+	if err != nil {
+		return s, err
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return s, err
+	}
+	defer zr.Close()
+
+	err = json.NewDecoder(zr).Decode(&s)
+	if err != nil {
+		return s, err
+	}
+	if s.Version != SnapshotVersion {
+		return s, fmt.Errorf("unsupported snapshot version %d, expected %d", s.Version, SnapshotVersion)
+	}
+	return s, nil
+}
+
+// RestoreSnapshot preloads the state from the configured snapshot file.
+// Restored data is marked as stale until it's reconciled with fresh data.
+func (p *Provider) RestoreSnapshot() error {
+	if p.cfg == nil || p.cfg.SnapshotFile == "" {
+		return nil
+	}
+	s, err := loadSnapshot(p.cfg.SnapshotFile)
+	if err != nil {
+		return err
+	}
+
+	p.dataLock.Lock()
+	defer p.dataLock.Unlock()
+	p.restoreSnapshotUnsafe(s)
+	p.SetDataReady(true)
+	log.WithFields(logrus.Fields{
+		"created_at": s.CreatedAt,
+		"airports":   len(s.Airports),
+		"pilots":     len(s.Pilots),
+	}).Info("snapshot restored, data is stale until fresh data arrives")
+	return nil
+}
+
+func (p *Provider) restoreSnapshotUnsafe(s snapshot) {
+	r := &restoredState{
+		static:         set.New[objectKey](),
+		dynamic:        set.New[objectKey](),
+		staticPending:  true,
+		dynamicPending: true,
+	}
+
+	for _, c := range s.Countries {
+		p.countries[c.Prefix] = c
+		r.static.Add(objectKey{vatspydata.ObjectTypeCountry, c.Prefix})
+	}
+	for _, fir := range s.FIRs {
+		p.firs[fir.ID] = fir
+		p.firsPrefix[fir.Prefix] = fir
+		r.static.Add(objectKey{vatspydata.ObjectTypeFIR, fir.ID})
+	}
+	for _, uir := range s.UIRs {
+		p.uirs[uir.ID] = uir
+		r.static.Add(objectKey{vatspydata.ObjectTypeUIR, uir.ID})
+	}
+	for _, arpt := range s.Airports {
+		if arpt.Runways == nil {
+			arpt.Runways = make(map[string]*ourairports.Runway)
+		}
+		p.airports[arpt.Meta.ICAO] = arpt
+		p.airportsIata[arpt.Meta.IATA] = arpt
+		p.airportsIndex.set(arpt.Meta.ICAO, arpt.Meta.Position)
+		r.static.Add(objectKey{vatspydata.ObjectTypeAirportMeta, arpt.Meta.ICAO})
+	}
+	for _, pilot := range s.Pilots {
+		pl := pilot
+		p.pilots[pl.Callsign] = pl
+		p.pilotsIndex.set(pl.Callsign, pilotPosition(pl))
+		p.updateTrafficUnsafe(nil, &pl)
+		r.dynamic.Add(objectKey{ObjectTypePilot, pl.Callsign})
+	}
+	for _, radar := range s.Radars {
+		p.radars[radar.Controller.Callsign] = radar
+		r.dynamic.Add(objectKey{ObjectTypeRadar, radar.Controller.Callsign})
+	}
+	for _, fss := range s.FSS {
+		p.fss[fss.Controller.Callsign] = fss
+		r.dynamic.Add(objectKey{ObjectTypeFSS, fss.Controller.Callsign})
+	}
+	for _, ur := range s.Unresolved {
+		p.unresolved[ur.Controller.Callsign] = ur
+		r.dynamic.Add(objectKey{ObjectTypeUnresolvedRadar, ur.Controller.Callsign})
+	}
+	for _, ctrl := range s.Controllers {
+		p.controllers[ctrl.Callsign] = ctrl
+		r.dynamic.Add(objectKey{ObjectTypeController, ctrl.Callsign})
+	}
+
+	p.restored = r
+}
+
+// IsStale returns true while the state restored from a snapshot
+// hasn't been reconciled with fresh data
+func (p *Provider) IsStale() bool {
+	p.dataLock.RLock()
+	defer p.dataLock.RUnlock()
+	return p.restored != nil
+}
+
+// touchUnsafe confirms a restored object by fresh data
+func (p *Provider) touchUnsafe(oType pubsub.ObjectType, id string) {
+	if p.restored == nil {
+		return
+	}
+	key := objectKey{oType, id}
+	p.restored.static.Delete(key)
+	p.restored.dynamic.Delete(key)
+}
+
+// reconcileStatic deletes restored static objects which are missing in fresh data
+func (p *Provider) reconcileStatic() {
+	p.dataLock.Lock()
+	if p.restored == nil || !p.restored.staticPending {
+		p.dataLock.Unlock()
+		return
+	}
+	p.restored.staticPending = false
+
+	countries := make([]vatspydata.Country, 0)
+	firs := make([]vatspydata.FIR, 0)
+	uirs := make([]vatspydata.UIR, 0)
+	airports := make([]vatspydata.AirportMeta, 0)
+	p.restored.static.Iter(func(key objectKey) {
+		switch key.oType {
+		case vatspydata.ObjectTypeCountry:
+			countries = append(countries, p.countries[key.id])
+		case vatspydata.ObjectTypeFIR:
+			firs = append(firs, p.firs[key.id])
+		case vatspydata.ObjectTypeUIR:
+			uirs = append(uirs, p.uirs[key.id])
+		case vatspydata.ObjectTypeAirportMeta:
+			airports = append(airports, p.airports[key.id].Meta)
+		}
+	})
+	p.finishRestoreUnsafe()
+	p.dataLock.Unlock()
+
+	log.WithField("count", len(countries)+len(firs)+len(uirs)+len(airports)).Info("reconciling restored static data")
+	for _, am := range airports {
+		p.deleteAirport(am)
+	}
+	for _, uir := range uirs {
+		p.deleteUIR(uir)
+	}
+	for _, fir := range firs {
+		p.deleteFIR(fir)
+	}
+	for _, c := range countries {
+		p.deleteCountry(c)
+	}
+}
+
+// reconcileDynamic deletes restored pilots and controllers which are offline
+func (p *Provider) reconcileDynamic() {
+	p.dataLock.Lock()
+	if p.restored == nil || !p.restored.dynamicPending {
+		p.dataLock.Unlock()
+		return
+	}
+	p.restored.dynamicPending = false
+
+	pilots := make([]Pilot, 0)
+	controllers := make([]Controller, 0)
+	leftovers := make([]objectKey, 0)
+	p.restored.dynamic.Iter(func(key objectKey) {
+		switch key.oType {
+		case ObjectTypePilot:
+			if pilot, found := p.pilots[key.id]; found {
+				pilots = append(pilots, pilot)
+			}
+		case ObjectTypeController:
+			if ctrl, found := p.controllers[key.id]; found {
+				controllers = append(controllers, ctrl)
+			}
+		case ObjectTypeRadar, ObjectTypeFSS, ObjectTypeUnresolvedRadar:
+			// the controller may be online with another facility
+			// or missing from the snapshot at all
+			leftovers = append(leftovers, key)
+		}
+	})
+	for _, key := range leftovers {
+		p.deleteLeftoverUnsafe(key)
+	}
+	p.finishRestoreUnsafe()
+	p.dataLock.Unlock()
+
+	log.WithField("count", len(pilots)+len(controllers)+len(leftovers)).Info("reconciling restored dynamic data")
+	for _, pilot := range pilots {
+		p.deletePilot(pilot.Pilot)
+	}
+	for _, ctrl := range controllers {
+		p.deleteController(ctrl.Controller)
+	}
+}
+
+// deleteLeftoverUnsafe deletes a restored radar, fss or unresolved radar
+// which hasn't been set by fresh data
+func (p *Provider) deleteLeftoverUnsafe(key objectKey) {
+	switch key.oType {
+	case ObjectTypeRadar:
+		if radar, found := p.radars[key.id]; found {
+			delete(p.radars, key.id)
+			p.Notify(pubsub.Update{UType: pubsub.UpdateTypeDelete, OType: ObjectTypeRadar, Obj: radar})
+		}
+	case ObjectTypeFSS:
+		if fss, found := p.fss[key.id]; found {
+			delete(p.fss, key.id)
+			p.Notify(pubsub.Update{UType: pubsub.UpdateTypeDelete, OType: ObjectTypeFSS, Obj: fss})
+		}
+	case ObjectTypeUnresolvedRadar:
+		p.deleteUnresolvedRadarUnsafe(key.id)
+	}
+}
+
+func (p *Provider) finishRestoreUnsafe() {
+	if !p.restored.staticPending && !p.restored.dynamicPending {
+		p.restored = nil
+		log.Info("restored data reconciled")
+	}
+}
@@ -0,0 +1,112 @@
+package merged
+
+import (
+	"path/filepath"
+	"testing"
+
+	vatsimapi "github.com/vatsimnerd/simwatch-providers/vatsim-api"
+	vatspydata "github.com/vatsimnerd/simwatch-providers/vatspy-data"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	cfg := &Config{SnapshotFile: filepath.Join(t.TempDir(), "state.json.gz")}
+
+	p := New(nil, nil, nil)
+	p.SetConfig(cfg)
+	p.setFIR(vatspydata.FIR{ID: "EGTT", Name: "London", Prefix: "EGTT"})
+	p.setAirport(vatspydata.AirportMeta{ICAO: "EGLL", IATA: "LHR", Name: "Heathrow"})
+	p.setAirport(vatspydata.AirportMeta{ICAO: "EGKK", IATA: "LGW", Name: "Gatwick"})
+	p.setController(vatsimapi.Controller{Callsign: "EGLL_TWR", Facility: vatsimapi.FacilityTower})
+	p.setController(vatsimapi.Controller{Callsign: "EGTT_CTR", Facility: vatsimapi.FacilityRadar})
+	p.setPilot(vatsimapi.Pilot{Callsign: "BAW1"})
+	p.setPilot(vatsimapi.Pilot{Callsign: "BAW2"})
+
+	if err := p.SaveSnapshot(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	r := New(nil, nil, nil)
+	r.SetConfig(cfg)
+	if err := r.RestoreSnapshot(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !r.IsStale() {
+		t.Error("expected restored data to be stale")
+	}
+
+	arpt, err := r.GetAirport("LHR")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(arpt.Controllers.Tower) != 1 {
+		t.Errorf("expected tower to be restored, got %+v", arpt.Controllers)
+	}
+	if _, err := r.GetRadar("EGTT_CTR"); err != nil {
+		t.Errorf("expected radar to be restored: %v", err)
+	}
+
+	// fresh data has lost EGKK, BAW2 and the radar
+	r.setFIR(vatspydata.FIR{ID: "EGTT", Name: "London", Prefix: "EGTT"})
+	r.setAirport(vatspydata.AirportMeta{ICAO: "EGLL", IATA: "LHR", Name: "Heathrow"})
+	r.reconcileStatic()
+	if !r.IsStale() {
+		t.Error("expected data to be stale until dynamic data is reconciled")
+	}
+	r.setController(vatsimapi.Controller{Callsign: "EGLL_TWR", Facility: vatsimapi.FacilityTower})
+	r.setPilot(vatsimapi.Pilot{Callsign: "BAW1"})
+	r.reconcileDynamic()
+
+	if r.IsStale() {
+		t.Error("expected data to be reconciled")
+	}
+	if _, err := r.GetAirport("EGKK"); err != ErrNotFound {
+		t.Errorf("expected EGKK to be deleted, got %v", err)
+	}
+	if _, err := r.GetPilot("BAW2"); err != ErrNotFound {
+		t.Errorf("expected BAW2 to be deleted, got %v", err)
+	}
+	if _, err := r.GetRadar("EGTT_CTR"); err != ErrNotFound {
+		t.Errorf("expected EGTT_CTR to be deleted, got %v", err)
+	}
+	if _, err := r.GetPilot("BAW1"); err != nil {
+		t.Errorf("expected BAW1 to stay, got %v", err)
+	}
+	arpt, _ = r.GetAirport("EGLL")
+	if len(arpt.Controllers.Tower) != 1 {
+		t.Errorf("expected tower to stay, got %+v", arpt.Controllers)
+	}
+}
+
+func TestSnapshotRestoreLeftovers(t *testing.T) {
+	p := New(nil, nil, nil)
+	p.dataLock.Lock()
+	p.restoreSnapshotUnsafe(snapshot{
+		FIRs: []vatspydata.FIR{{ID: "EGTT", Name: "London", Prefix: "EGTT"}},
+		// radar and unresolved radar without controllers
+		Radars:     []Radar{{Controller: vatsimapi.Controller{Callsign: "EGPX_CTR", Facility: vatsimapi.FacilityRadar}}},
+		Unresolved: []UnresolvedRadar{{Controller: vatsimapi.Controller{Callsign: "XXXX_CTR", Facility: vatsimapi.FacilityRadar}}},
+		// fss coming back online as a radar
+		FSS:         []FSS{{Controller: vatsimapi.Controller{Callsign: "EGTT_CTR", Facility: vatsimapi.FacilityFSS}}},
+		Controllers: []Controller{{Controller: vatsimapi.Controller{Callsign: "EGTT_CTR", Facility: vatsimapi.FacilityFSS}}},
+	})
+	p.dataLock.Unlock()
+
+	p.setController(vatsimapi.Controller{Callsign: "EGTT_CTR", Facility: vatsimapi.FacilityRadar})
+	p.reconcileDynamic()
+
+	if _, err := p.GetRadar("EGPX_CTR"); err != ErrNotFound {
+		t.Errorf("expected orphaned radar to be deleted, got %v", err)
+	}
+	if urs := p.ListUnresolvedRadars(); len(urs) != 0 {
+		t.Errorf("expected orphaned unresolved radar to be deleted, got %+v", urs)
+	}
+	if _, err := p.GetFSS("EGTT_CTR"); err != ErrNotFound {
+		t.Errorf("expected restored fss to be deleted, got %v", err)
+	}
+	if _, err := p.GetRadar("EGTT_CTR"); err != nil {
+		t.Errorf("expected fresh radar to stay, got %v", err)
+	}
+	if _, err := p.GetController("EGTT_CTR"); err != nil {
+		t.Errorf("expected fresh controller to stay, got %v", err)
+	}
+}
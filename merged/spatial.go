@@ -0,0 +1,282 @@
+package merged
+
+import (
+	"math"
+
+	vatspydata "github.com/vatsimnerd/simwatch-providers/vatspy-data"
+	"github.com/vatsimnerd/util/set"
+)
+
+const (
+	spatialCellSize = 1.0
+)
+
+type (
+	// Rect is a geographic bounding box. When Min.Lng is greater than Max.Lng
+	// the box is considered to cross the antimeridian
+	Rect struct {
+		Min vatspydata.Point `json:"min"`
+		Max vatspydata.Point `json:"max"`
+	}
+
+	cell struct {
+		lat int
+		lng int
+	}
+
+	// spatialIndex is a simple grid index, each cell covers
+	// spatialCellSize x spatialCellSize degrees
+	spatialIndex struct {
+		cells  map[cell]*set.Set[string]
+		points map[string]vatspydata.Point
+	}
+)
+
+func newSpatialIndex() *spatialIndex {
+	return &spatialIndex{
+		cells:  make(map[cell]*set.Set[string]),
+		points: make(map[string]vatspydata.Point),
+	}
+}
+
+func cellOf(pt vatspydata.Point) cell {
+	return cell{
+		lat: int(math.Floor(pt.Lat / spatialCellSize)),
+		lng: int(math.Floor(normalizeLng(pt.Lng) / spatialCellSize)),
+	}
+}
+
+func (r Rect) crossesAntimeridian() bool {
+	return r.Min.Lng > r.Max.Lng
+}
+
+// Contains reports whether the point is inside the box
+func (r Rect) Contains(pt vatspydata.Point) bool {
+	if pt.Lat < r.Min.Lat || pt.Lat > r.Max.Lat {
+		return false
+	}
+	lng := normalizeLng(pt.Lng)
+	if r.crossesAntimeridian() {
+		return lng >= r.Min.Lng || lng <= r.Max.Lng
+	}
+	return lng >= r.Min.Lng && lng <= r.Max.Lng
+}
+
+// polygon returns the box as a polygon, the longitude of the eastern
+// edge of a box crossing the antimeridian is beyond 180
+func (r Rect) polygon() []vatspydata.Point {
+	maxLng := r.Max.Lng
+	if r.crossesAntimeridian() {
+		maxLng += 360
+	}
+	return []vatspydata.Point{
+		{Lat: r.Min.Lat, Lng: r.Min.Lng},
+		{Lat: r.Max.Lat, Lng: r.Min.Lng},
+		{Lat: r.Max.Lat, Lng: maxLng},
+		{Lat: r.Min.Lat, Lng: maxLng},
+	}
+}
+
+// normalized swaps inverted latitudes and brings longitudes into
+// [-180, 180] range, a box 360 degrees wide or wider covers every longitude
+func (r Rect) normalized() Rect {
+	if r.Min.Lat > r.Max.Lat {
+		r.Min.Lat, r.Max.Lat = r.Max.Lat, r.Min.Lat
+	}
+	if r.Max.Lng-r.Min.Lng >= 360 {
+		r.Min.Lng, r.Max.Lng = -180, 180
+		return r
+	}
+	r.Min.Lng = normalizeLng(r.Min.Lng)
+	r.Max.Lng = normalizeLng(r.Max.Lng)
+	if r.Max.Lng == -180 && r.Min.Lng != -180 {
+		r.Max.Lng = 180
+	}
+	return r
+}
+
+// lngRanges splits the box into one or two non-wrapping longitude ranges
+func (r Rect) lngRanges() [][2]float64 {
+	if r.crossesAntimeridian() {
+		return [][2]float64{{r.Min.Lng, 180}, {-180, r.Max.Lng}}
+	}
+	return [][2]float64{{r.Min.Lng, r.Max.Lng}}
+}
+
+// radiusRect returns a bounding box enclosing a circle
+func radiusRect(center vatspydata.Point, radiusNM float64) Rect {
+	dLat := radiusNM / 60
+	minLat := math.Max(-90, center.Lat-dLat)
+	maxLat := math.Min(90, center.Lat+dLat)
+
+	cosLat := math.Min(math.Cos(toRad(minLat)), math.Cos(toRad(maxLat)))
+	if cosLat <= 0 || radiusNM/60/cosLat >= 180 {
+		return Rect{
+			Min: vatspydata.Point{Lat: minLat, Lng: -180},
+			Max: vatspydata.Point{Lat: maxLat, Lng: 180},
+		}
+	}
+	dLng := radiusNM / 60 / cosLat
+	return Rect{
+		Min: vatspydata.Point{Lat: minLat, Lng: normalizeLng(center.Lng - dLng)},
+		Max: vatspydata.Point{Lat: maxLat, Lng: normalizeLng(center.Lng + dLng)},
+	}
+}
+
+func (si *spatialIndex) set(id string, pt vatspydata.Point) {
+	if ex, found := si.points[id]; found {
+		if ex == pt {
+			return
+		}
+		si.delete(id)
+	}
+	c := cellOf(pt)
+	ids, found := si.cells[c]
+	if !found {
+		ids = set.New[string]()
+		si.cells[c] = ids
+	}
+	ids.Add(id)
+	si.points[id] = pt
+}
+
+func (si *spatialIndex) delete(id string) {
+	pt, found := si.points[id]
+	if !found {
+		return
+	}
+	c := cellOf(pt)
+	if ids, found := si.cells[c]; found {
+		ids.Delete(id)
+		if ids.Size() == 0 {
+			delete(si.cells, c)
+		}
+	}
+	delete(si.points, id)
+}
+
+func (si *spatialIndex) inRect(r Rect) []string {
+	results := make([]string, 0)
+	r = r.normalized()
+	minLat := int(math.Floor(r.Min.Lat / spatialCellSize))
+	maxLat := int(math.Floor(r.Max.Lat / spatialCellSize))
+
+	for _, lr := range r.lngRanges() {
+		minLng := int(math.Floor(lr[0] / spatialCellSize))
+		maxLng := int(math.Floor(lr[1] / spatialCellSize))
+		for lat := minLat; lat <= maxLat; lat++ {
+			for lng := minLng; lng <= maxLng; lng++ {
+				ids, found := si.cells[cell{lat, lng}]
+				if !found {
+					continue
+				}
+				ids.Iter(func(id string) {
+					if r.Contains(si.points[id]) {
+						results = append(results, id)
+					}
+				})
+			}
+		}
+	}
+
+	// a cell may be scanned twice when both ranges touch it
+	if len(r.lngRanges()) > 1 {
+		results = set.FromList(results).List()
+	}
+	return results
+}
+
+func (si *spatialIndex) inRadius(center vatspydata.Point, radiusNM float64) []string {
+	results := make([]string, 0)
+	for _, id := range si.inRect(radiusRect(center, radiusNM)) {
+		if distanceNM(center, si.points[id]) <= radiusNM {
+			results = append(results, id)
+		}
+	}
+	return results
+}
+
+func pilotPosition(p Pilot) vatspydata.Point {
+	return vatspydata.Point{Lat: p.Latitude, Lng: p.Longitude}
+}
+
+// PilotsInRect returns pilots located inside the bounding box
+func (p *Provider) PilotsInRect(r Rect) []Pilot {
+	p.dataLock.RLock()
+	defer p.dataLock.RUnlock()
+	pilots := make([]Pilot, 0)
+	for _, callsign := range p.pilotsIndex.inRect(r) {
+		if pilot, found := p.pilots[callsign]; found {
+			pilots = append(pilots, pilot.Copy())
+		}
+	}
+	return pilots
+}
+
+// PilotsInRadius returns pilots located within radiusNM nautical miles from center
+func (p *Provider) PilotsInRadius(center vatspydata.Point, radiusNM float64) []Pilot {
+	p.dataLock.RLock()
+	defer p.dataLock.RUnlock()
+	pilots := make([]Pilot, 0)
+	for _, callsign := range p.pilotsIndex.inRadius(center, radiusNM) {
+		if pilot, found := p.pilots[callsign]; found {
+			pilots = append(pilots, pilot.Copy())
+		}
+	}
+	return pilots
+}
+
+// AirportsInRect returns airports located inside the bounding box
+func (p *Provider) AirportsInRect(r Rect) []Airport {
+	p.dataLock.RLock()
+	defer p.dataLock.RUnlock()
+	airports := make([]Airport, 0)
+	for _, icao := range p.airportsIndex.inRect(r) {
+		if arpt, found := p.airports[icao]; found {
+			airports = append(airports, arpt.Copy())
+		}
+	}
+	return airports
+}
+
+// AirportsInRadius returns airports located within radiusNM nautical miles from center
+func (p *Provider) AirportsInRadius(center vatspydata.Point, radiusNM float64) []Airport {
+	p.dataLock.RLock()
+	defer p.dataLock.RUnlock()
+	airports := make([]Airport, 0)
+	for _, icao := range p.airportsIndex.inRadius(center, radiusNM) {
+		if arpt, found := p.airports[icao]; found {
+			airports = append(airports, arpt.Copy())
+		}
+	}
+	return airports
+}
+
+// Intersects reports whether two boxes overlap
+func (r Rect) Intersects(o Rect) bool {
+	if r.Max.Lat < o.Min.Lat || r.Min.Lat > o.Max.Lat {
+		return false
+	}
+	for _, lr := range r.lngRanges() {
+		for _, olr := range o.lngRanges() {
+			if lr[0] <= olr[1] && olr[0] <= lr[1] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func boundingRect(poly []vatspydata.Point) Rect {
+	r := Rect{
+		Min: vatspydata.Point{Lat: 90, Lng: 180},
+		Max: vatspydata.Point{Lat: -90, Lng: -180},
+	}
+	for _, pt := range poly {
+		r.Min.Lat = math.Min(r.Min.Lat, pt.Lat)
+		r.Min.Lng = math.Min(r.Min.Lng, pt.Lng)
+		r.Max.Lat = math.Max(r.Max.Lat, pt.Lat)
+		r.Max.Lng = math.Max(r.Max.Lng, pt.Lng)
+	}
+	return r
+}
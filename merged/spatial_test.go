@@ -0,0 +1,83 @@
+package merged
+
+import (
+	"testing"
+
+	vatspydata "github.com/vatsimnerd/simwatch-providers/vatspy-data"
+	"github.com/vatsimnerd/util/set"
+)
+
+func TestSpatialIndexRect(t *testing.T) {
+	si := newSpatialIndex()
+	si.set("EGLL", vatspydata.Point{Lat: 51.4775, Lng: -0.4614})
+	si.set("LFPG", vatspydata.Point{Lat: 49.0097, Lng: 2.5479})
+	si.set("NZAA", vatspydata.Point{Lat: -37.0081, Lng: 174.7917})
+	si.set("NSTU", vatspydata.Point{Lat: -14.3310, Lng: -170.7105})
+
+	type testcase struct {
+		name string
+		rect Rect
+		exp  *set.Set[string]
+	}
+
+	testcases := []testcase{
+		{
+			name: "europe",
+			rect: Rect{Min: vatspydata.Point{Lat: 45, Lng: -5}, Max: vatspydata.Point{Lat: 55, Lng: 5}},
+			exp:  set.FromList([]string{"EGLL", "LFPG"}),
+		},
+		{
+			name: "antimeridian",
+			rect: Rect{Min: vatspydata.Point{Lat: -40, Lng: 170}, Max: vatspydata.Point{Lat: -10, Lng: -165}},
+			exp:  set.FromList([]string{"NZAA", "NSTU"}),
+		},
+		{
+			name: "inverted latitudes",
+			rect: Rect{Min: vatspydata.Point{Lat: 55, Lng: -5}, Max: vatspydata.Point{Lat: 45, Lng: 5}},
+			exp:  set.FromList([]string{"EGLL", "LFPG"}),
+		},
+		{
+			name: "unwrapped antimeridian",
+			rect: Rect{Min: vatspydata.Point{Lat: -40, Lng: 170}, Max: vatspydata.Point{Lat: -10, Lng: 195}},
+			exp:  set.FromList([]string{"NZAA", "NSTU"}),
+		},
+		{
+			name: "whole world",
+			rect: Rect{Min: vatspydata.Point{Lat: -90, Lng: -180}, Max: vatspydata.Point{Lat: 90, Lng: 180}},
+			exp:  set.FromList([]string{"EGLL", "LFPG", "NZAA", "NSTU"}),
+		},
+		{
+			name: "empty",
+			rect: Rect{Min: vatspydata.Point{Lat: 0, Lng: 0}, Max: vatspydata.Point{Lat: 10, Lng: 10}},
+			exp:  set.New[string](),
+		},
+	}
+
+	for _, tc := range testcases {
+		res := set.FromList(si.inRect(tc.rect))
+		if !res.Eq(tc.exp) {
+			t.Errorf("[%s] expected %s, got %s", tc.name, tc.exp, res)
+		}
+	}
+
+	si.set("LFPG", vatspydata.Point{Lat: -36.5, Lng: 175})
+	si.delete("NSTU")
+	res := set.FromList(si.inRect(testcases[1].rect))
+	exp := set.FromList([]string{"NZAA", "LFPG"})
+	if !res.Eq(exp) {
+		t.Errorf("[moved] expected %s, got %s", exp, res)
+	}
+}
+
+func TestSpatialIndexRadius(t *testing.T) {
+	si := newSpatialIndex()
+	si.set("EGLL", vatspydata.Point{Lat: 51.4775, Lng: -0.4614})
+	si.set("EGKK", vatspydata.Point{Lat: 51.1481, Lng: -0.1903})
+	si.set("LFPG", vatspydata.Point{Lat: 49.0097, Lng: 2.5479})
+
+	res := set.FromList(si.inRadius(vatspydata.Point{Lat: 51.4775, Lng: -0.4614}, 50))
+	exp := set.FromList([]string{"EGLL", "EGKK"})
+	if !res.Eq(exp) {
+		t.Errorf("expected %s, got %s", exp, res)
+	}
+}
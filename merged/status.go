@@ -0,0 +1,82 @@
+package merged
+
+import (
+	"sort"
+
+	simwatchproviders "github.com/vatsimnerd/simwatch-providers"
+)
+
+// Status reports the overall provider health combined from the
+// sub-providers statuses which are reported as children.
+//
+// A running provider is degraded if any sub-provider has failed or
+// is degraded and stale if any sub-provider is stale or the state
+// restored from a snapshot hasn't been reconciled yet. LastSuccess
+// is the oldest last success among the sub-providers.
+func (p *Provider) Status() simwatchproviders.Status {
+	children := []simwatchproviders.Status{
+		p.static.Status(),
+		p.dynamic.Status(),
+		p.runways.Status(),
+	}
+
+	p.dataLock.RLock()
+	objects := map[string]int{
+		"airports":          len(p.airports),
+		"pilots":            len(p.pilots),
+		"controllers":       len(p.controllers),
+		"radars":            len(p.radars),
+		"fss":               len(p.fss),
+		"unresolved_radars": len(p.unresolved),
+		"countries":         len(p.countries),
+		"firs":              len(p.firs),
+		"uirs":              len(p.uirs),
+	}
+	bootErrors := make([]string, 0, len(p.degraded))
+	for name, err := range p.degraded {
+		bootErrors = append(bootErrors, name+": "+err.Error())
+	}
+	stale := p.restored != nil
+	p.dataLock.RUnlock()
+	sort.Strings(bootErrors)
+
+	s := simwatchproviders.Status{
+		Name:       "merged",
+		State:      p.life.State(),
+		PollPeriod: children[1].PollPeriod,
+		Objects:    objects,
+		Children:   children,
+	}
+
+	degraded := len(bootErrors) > 0
+	for i, c := range children {
+		if i == 0 || c.LastSuccess.Before(s.LastSuccess) {
+			s.LastSuccess = c.LastSuccess
+		}
+		if c.ConsecutiveFailures > s.ConsecutiveFailures {
+			s.ConsecutiveFailures = c.ConsecutiveFailures
+			s.LastError = c.LastError
+		}
+		switch c.State {
+		case simwatchproviders.StateDegraded:
+			degraded = true
+		case simwatchproviders.StateStale:
+			stale = true
+		}
+	}
+
+	// boot errors are reported in favour of fetch errors
+	// as they explain why the provider is degraded
+	if len(bootErrors) > 0 {
+		s.LastError = bootErrors[0]
+	}
+
+	if s.State == simwatchproviders.StateReady {
+		if degraded {
+			s.State = simwatchproviders.StateDegraded
+		} else if stale {
+			s.State = simwatchproviders.StateStale
+		}
+	}
+	return s
+}
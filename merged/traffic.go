@@ -0,0 +1,122 @@
+package merged
+
+import (
+	"sort"
+
+	"github.com/vatsimnerd/util/pubsub"
+	"github.com/vatsimnerd/util/set"
+)
+
+type trafficIndex struct {
+	inbound  map[string]*set.Set[string]
+	outbound map[string]*set.Set[string]
+}
+
+func newTrafficIndex() *trafficIndex {
+	return &trafficIndex{
+		inbound:  make(map[string]*set.Set[string]),
+		outbound: make(map[string]*set.Set[string]),
+	}
+}
+
+func addToIndex(idx map[string]*set.Set[string], icao string, callsign string) {
+	s, found := idx[icao]
+	if !found {
+		s = set.New[string]()
+		idx[icao] = s
+	}
+	s.Add(callsign)
+}
+
+func deleteFromIndex(idx map[string]*set.Set[string], icao string, callsign string) {
+	if s, found := idx[icao]; found {
+		s.Delete(callsign)
+		if s.Size() == 0 {
+			delete(idx, icao)
+		}
+	}
+}
+
+func sortedList(s *set.Set[string]) []string {
+	if s == nil {
+		return []string{}
+	}
+	list := s.List()
+	sort.Strings(list)
+	return list
+}
+
+func (ti *trafficIndex) traffic(icao string) AirportTraffic {
+	t := AirportTraffic{
+		Inbound:  sortedList(ti.inbound[icao]),
+		Outbound: sortedList(ti.outbound[icao]),
+	}
+	t.InboundCount = len(t.Inbound)
+	t.OutboundCount = len(t.Outbound)
+	return t
+}
+
+// resolveFlightPlanUnsafe returns ICAO codes of the departure and arrival
+// airports of the pilot, empty strings mean no flight plan or unknown airport
+func (p *Provider) resolveFlightPlanUnsafe(pilot *Pilot) (string, string) {
+	if pilot == nil || pilot.FlightPlan == nil {
+		return "", ""
+	}
+	var dep, arr string
+	if arpt, err := p.findAirportUnsafe(pilot.FlightPlan.Departure); err == nil {
+		dep = arpt.Meta.ICAO
+	}
+	if arpt, err := p.findAirportUnsafe(pilot.FlightPlan.Arrival); err == nil {
+		arr = arpt.Meta.ICAO
+	}
+	return dep, arr
+}
+
+// updateTrafficUnsafe moves the pilot between airports' inbound and outbound
+// lists. prev is nil for a new pilot, cur is nil for a disconnected one.
+func (p *Provider) updateTrafficUnsafe(prev *Pilot, cur *Pilot) {
+	var callsign string
+	if cur != nil {
+		callsign = cur.Callsign
+	} else if prev != nil {
+		callsign = prev.Callsign
+	} else {
+		return
+	}
+
+	prevDep, prevArr := p.resolveFlightPlanUnsafe(prev)
+	curDep, curArr := p.resolveFlightPlanUnsafe(cur)
+
+	affected := set.New[string]()
+	if prevDep != curDep {
+		if prevDep != "" {
+			deleteFromIndex(p.traffic.outbound, prevDep, callsign)
+			affected.Add(prevDep)
+		}
+		if curDep != "" {
+			addToIndex(p.traffic.outbound, curDep, callsign)
+			affected.Add(curDep)
+		}
+	}
+	if prevArr != curArr {
+		if prevArr != "" {
+			deleteFromIndex(p.traffic.inbound, prevArr, callsign)
+			affected.Add(prevArr)
+		}
+		if curArr != "" {
+			addToIndex(p.traffic.inbound, curArr, callsign)
+			affected.Add(curArr)
+		}
+	}
+
+	affected.Iter(func(icao string) {
+		arpt, found := p.airports[icao]
+		if !found {
+			return
+		}
+		arpt.Traffic = p.traffic.traffic(icao)
+		p.airports[icao] = arpt
+		p.airportsIata[arpt.Meta.IATA] = arpt
+		p.Notify(pubsub.Update{UType: pubsub.UpdateTypeSet, OType: ObjectTypeAirport, Obj: arpt})
+	})
+}
@@ -0,0 +1,113 @@
+package merged
+
+import (
+	"testing"
+
+	vatsimapi "github.com/vatsimnerd/simwatch-providers/vatsim-api"
+	vatspydata "github.com/vatsimnerd/simwatch-providers/vatspy-data"
+)
+
+func TestTrafficIndex(t *testing.T) {
+	p := New(nil, nil, nil)
+	p.setAirport(vatspydata.AirportMeta{ICAO: "EGLL", IATA: "LHR", Name: "Heathrow"})
+	p.setAirport(vatspydata.AirportMeta{ICAO: "LFPG", IATA: "CDG", Name: "Charles de Gaulle"})
+	p.setAirport(vatspydata.AirportMeta{ICAO: "EDDF", IATA: "FRA", Name: "Frankfurt"})
+
+	fp := func(dep, arr string) *vatsimapi.FlightPlan {
+		return &vatsimapi.FlightPlan{Departure: dep, Arrival: arr}
+	}
+
+	type traffic struct {
+		inbound  []string
+		outbound []string
+	}
+
+	testcases := []struct {
+		name   string
+		pilot  vatsimapi.Pilot
+		logoff bool
+		exp    map[string]traffic
+	}{
+		{
+			name:  "no flight plan",
+			pilot: vatsimapi.Pilot{Callsign: "BAW1"},
+			exp:   map[string]traffic{"EGLL": {}, "LFPG": {}},
+		},
+		{
+			name:  "flight plan filed",
+			pilot: vatsimapi.Pilot{Callsign: "BAW1", FlightPlan: fp("EGLL", "LFPG")},
+			exp: map[string]traffic{
+				"EGLL": {outbound: []string{"BAW1"}},
+				"LFPG": {inbound: []string{"BAW1"}},
+			},
+		},
+		{
+			name:  "second pilot by iata codes",
+			pilot: vatsimapi.Pilot{Callsign: "AFR2", FlightPlan: fp("CDG", "LHR")},
+			exp: map[string]traffic{
+				"EGLL": {inbound: []string{"AFR2"}, outbound: []string{"BAW1"}},
+				"LFPG": {inbound: []string{"BAW1"}, outbound: []string{"AFR2"}},
+			},
+		},
+		{
+			name:  "arrival amended",
+			pilot: vatsimapi.Pilot{Callsign: "BAW1", FlightPlan: fp("EGLL", "EDDF")},
+			exp: map[string]traffic{
+				"EGLL": {inbound: []string{"AFR2"}, outbound: []string{"BAW1"}},
+				"LFPG": {outbound: []string{"AFR2"}},
+				"EDDF": {inbound: []string{"BAW1"}},
+			},
+		},
+		{
+			name:  "unknown departure",
+			pilot: vatsimapi.Pilot{Callsign: "BAW1", FlightPlan: fp("ZZZZ", "EDDF")},
+			exp: map[string]traffic{
+				"EGLL": {inbound: []string{"AFR2"}},
+				"EDDF": {inbound: []string{"BAW1"}},
+			},
+		},
+		{
+			name:   "logoff",
+			pilot:  vatsimapi.Pilot{Callsign: "AFR2"},
+			logoff: true,
+			exp: map[string]traffic{
+				"EGLL": {},
+				"LFPG": {},
+				"EDDF": {inbound: []string{"BAW1"}},
+			},
+		},
+		{
+			name:  "flight plan removed",
+			pilot: vatsimapi.Pilot{Callsign: "BAW1"},
+			exp:   map[string]traffic{"EGLL": {}, "LFPG": {}, "EDDF": {}},
+		},
+	}
+
+	equal := func(a, b []string) bool {
+		if len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if a[i] != b[i] {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, tc := range testcases {
+		if tc.logoff {
+			p.deletePilot(tc.pilot)
+		} else {
+			p.setPilot(tc.pilot)
+		}
+		for icao, exp := range tc.exp {
+			arpt, _ := p.GetAirport(icao)
+			tr := arpt.Traffic
+			if !equal(tr.Inbound, exp.inbound) || !equal(tr.Outbound, exp.outbound) ||
+				tr.InboundCount != len(exp.inbound) || tr.OutboundCount != len(exp.outbound) {
+				t.Errorf("%s: expected %s inbound %v outbound %v, got %+v", tc.name, icao, exp.inbound, exp.outbound, tr)
+			}
+		}
+	}
+}
@@ -13,66 +13,96 @@ type (
 	Pilot struct {
 		vatsimapi.Pilot
 		AircraftType *aircraft.AircraftType `json:"aircraft_type"`
+		FIRID        string                 `json:"fir_id"`
+		UIRID        string                 `json:"uir_id,omitempty"`
+		Country      string                 `json:"country,omitempty"`
+		Oceanic      bool                   `json:"oceanic"`
+		Phase        FlightPhase            `json:"phase"`
+		Progress     *FlightProgress        `json:"progress"`
 	}
 
-	ControllerSet struct {
-		ATIS     *vatsimapi.Controller `json:"atis"`
-		Delivery *vatsimapi.Controller `json:"del"`
-		Ground   *vatsimapi.Controller `json:"gnd"`
-		Tower    *vatsimapi.Controller `json:"twr"`
-		Approach *vatsimapi.Controller `json:"appr"`
+	AirportTraffic struct {
+		Inbound       []string `json:"inbound"`
+		Outbound      []string `json:"outbound"`
+		InboundCount  int      `json:"inbound_count"`
+		OutboundCount int      `json:"outbound_count"`
 	}
 
 	Airport struct {
 		Meta        vatspydata.AirportMeta         `json:"meta"`
 		Controllers ControllerSet                  `json:"ctrls"`
 		Runways     map[string]*ourairports.Runway `json:"rwys"`
+		Traffic     AirportTraffic                 `json:"traffic"`
+		DecodedATIS map[string]DecodedATIS         `json:"decoded_atis"`
 	}
 
 	Radar struct {
 		Controller vatsimapi.Controller      `json:"ctrl"`
 		FIRs       map[string]vatspydata.FIR `json:"firs"`
 	}
+
+	// Controller is an ATC position with its resolved airport or FIRs.
+	// Position is set for airport positions, Bounds holds bounding boxes
+	// of the FIRs in the order of FIRIDs.
+	Controller struct {
+		vatsimapi.Controller
+		AirportICAO string            `json:"airport,omitempty"`
+		FIRIDs      []string          `json:"firs,omitempty"`
+		Position    *vatspydata.Point `json:"position,omitempty"`
+		Bounds      []Rect            `json:"bounds,omitempty"`
+	}
+
+	FSS struct {
+		Controller vatsimapi.Controller      `json:"ctrl"`
+		FIRs       map[string]vatspydata.FIR `json:"firs"`
+	}
+
+	// UnresolvedRadar is a radar controller which callsign prefix
+	// couldn't be resolved to any FIR
+	UnresolvedRadar struct {
+		Controller vatsimapi.Controller `json:"ctrl"`
+		Prefix     string               `json:"prefix"`
+	}
 )
 
 func (p Pilot) NE(o Pilot) bool {
-	return p.Pilot.NE(o.Pilot)
+	return p.Pilot.NE(o.Pilot) || p.FIRID != o.FIRID || p.Phase != o.Phase
 }
 
 func (a Airport) NE(o Airport) bool {
 	return a.Meta.NE(o.Meta) ||
-		a.Controllers.NE(o.Controllers)
+		a.Controllers.NE(o.Controllers) ||
+		a.Traffic.NE(o.Traffic)
 }
 
-func (a Airport) IsControlled() bool {
-	return !a.Controllers.IsEmpty()
-}
-
-func (cs ControllerSet) NE(o ControllerSet) bool {
-	if (cs.ATIS == nil) != (o.ATIS == nil) || ((cs.ATIS != nil) && cs.ATIS.NE(*o.ATIS)) {
-		return true
-	}
-	if (cs.Delivery == nil) != (o.Delivery == nil) || ((cs.Delivery != nil) && cs.Delivery.NE(*o.Delivery)) {
-		return true
-	}
-	if (cs.Ground == nil) != (o.Ground == nil) || ((cs.Ground != nil) && cs.Ground.NE(*o.Ground)) {
+func (t AirportTraffic) NE(o AirportTraffic) bool {
+	if len(t.Inbound) != len(o.Inbound) || len(t.Outbound) != len(o.Outbound) {
 		return true
 	}
-	if (cs.Tower == nil) != (o.Tower == nil) || ((cs.Tower != nil) && cs.Tower.NE(*o.Tower)) {
-		return true
+	for i := range t.Inbound {
+		if t.Inbound[i] != o.Inbound[i] {
+			return true
+		}
 	}
-	if (cs.Approach == nil) != (o.Approach == nil) || ((cs.Approach != nil) && cs.Approach.NE(*o.Approach)) {
-		return true
+	for i := range t.Outbound {
+		if t.Outbound[i] != o.Outbound[i] {
+			return true
+		}
 	}
 	return false
 }
 
-func (cs ControllerSet) IsEmpty() bool {
-	return cs.ATIS == nil &&
-		cs.Delivery == nil &&
-		cs.Ground == nil &&
-		cs.Tower == nil &&
-		cs.Approach == nil
+func (t AirportTraffic) Copy() AirportTraffic {
+	cp := t
+	cp.Inbound = make([]string, len(t.Inbound))
+	copy(cp.Inbound, t.Inbound)
+	cp.Outbound = make([]string, len(t.Outbound))
+	copy(cp.Outbound, t.Outbound)
+	return cp
+}
+
+func (a Airport) IsControlled() bool {
+	return !a.Controllers.IsEmpty()
 }
 
 func (r Radar) NE(o Radar) bool {
@@ -93,6 +123,98 @@ func (r Radar) NE(o Radar) bool {
 	return false
 }
 
+func (p Pilot) Copy() Pilot {
+	cp := p
+	cp.Pilot = p.Pilot.Copy()
+	if p.AircraftType != nil {
+		at := *p.AircraftType
+		cp.AircraftType = &at
+	}
+	cp.Progress = p.Progress.Copy()
+	return cp
+}
+
+func (a Airport) Copy() Airport {
+	cp := a
+	cp.Controllers = a.Controllers.Copy()
+	cp.Traffic = a.Traffic.Copy()
+	if a.DecodedATIS != nil {
+		cp.DecodedATIS = make(map[string]DecodedATIS, len(a.DecodedATIS))
+		for callsign, d := range a.DecodedATIS {
+			cp.DecodedATIS[callsign] = d.Copy()
+		}
+	}
+	cp.Runways = make(map[string]*ourairports.Runway, len(a.Runways))
+	for ident, rwy := range a.Runways {
+		r := *rwy
+		cp.Runways[ident] = &r
+	}
+	return cp
+}
+
+func (r Radar) Copy() Radar {
+	cp := r
+	cp.FIRs = make(map[string]vatspydata.FIR, len(r.FIRs))
+	for id, fir := range r.FIRs {
+		cp.FIRs[id] = fir.Copy()
+	}
+	return cp
+}
+
+func (c Controller) NE(o Controller) bool {
+	if c.Controller.NE(o.Controller) || c.AirportICAO != o.AirportICAO ||
+		len(c.FIRIDs) != len(o.FIRIDs) || len(c.Bounds) != len(o.Bounds) {
+		return true
+	}
+	if (c.Position == nil) != (o.Position == nil) || (c.Position != nil && *c.Position != *o.Position) {
+		return true
+	}
+	for i := range c.FIRIDs {
+		if c.FIRIDs[i] != o.FIRIDs[i] {
+			return true
+		}
+	}
+	for i := range c.Bounds {
+		if c.Bounds[i] != o.Bounds[i] {
+			return true
+		}
+	}
+	return false
+}
+
+func (c Controller) Copy() Controller {
+	cp := c
+	if c.FIRIDs != nil {
+		cp.FIRIDs = make([]string, len(c.FIRIDs))
+		copy(cp.FIRIDs, c.FIRIDs)
+	}
+	if c.Position != nil {
+		pos := *c.Position
+		cp.Position = &pos
+	}
+	if c.Bounds != nil {
+		cp.Bounds = make([]Rect, len(c.Bounds))
+		copy(cp.Bounds, c.Bounds)
+	}
+	return cp
+}
+
+func (f FSS) NE(o FSS) bool {
+	return Radar(f).NE(Radar(o))
+}
+
+func (f FSS) Copy() FSS {
+	return FSS(Radar(f).Copy())
+}
+
+func (r UnresolvedRadar) NE(o UnresolvedRadar) bool {
+	return r.Controller.NE(o.Controller) || r.Prefix != o.Prefix
+}
+
+func (r UnresolvedRadar) Copy() UnresolvedRadar {
+	return r
+}
+
 func makePilot(vp vatsimapi.Pilot) Pilot {
 	p := Pilot{Pilot: vp}
 	if p.FlightPlan != nil {
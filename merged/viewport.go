@@ -0,0 +1,328 @@
+package merged
+
+import (
+	"sync"
+
+	vatspydata "github.com/vatsimnerd/simwatch-providers/vatspy-data"
+	"github.com/vatsimnerd/util/pubsub"
+	"github.com/vatsimnerd/util/set"
+)
+
+type (
+	// Filter describes a geographic area and a set of object types
+	// a FilteredSubscription is interested in. If Polygon is set it takes
+	// precedence over Rect, if neither is set the area is the whole world.
+	// Polygon may cross the antimeridian, a polygon encircling a pole is
+	// reduced to the latitude band it covers. Empty Types list means all
+	// object types.
+	Filter struct {
+		Rect    *Rect
+		Polygon []vatspydata.Point
+		Types   []pubsub.ObjectType
+	}
+
+	// FilteredSubscription forwards only the updates matching its filter.
+	// Objects leaving the filter area are sent as synthetic deletes,
+	// objects entering it are sent as synthetic sets.
+	FilteredSubscription struct {
+		sub pubsub.Subscription
+		ch  chan pubsub.Update
+		// filterCh holds at most one pending filter,
+		// filterLock serializes SetFilter calls
+		filterCh   chan Filter
+		filterLock sync.Mutex
+		done       chan bool
+		once       sync.Once
+	}
+
+	objectKey struct {
+		oType pubsub.ObjectType
+		id    string
+	}
+
+	compiledFilter struct {
+		area *Rect
+		// poly is unwrapped, its longitudes are continuous
+		// within [minLng, maxLng] range
+		poly   []vatspydata.Point
+		minLng float64
+		maxLng float64
+		types  *set.Set[pubsub.ObjectType]
+	}
+)
+
+func compileFilter(f Filter) compiledFilter {
+	cf := compiledFilter{types: set.FromList(f.Types)}
+	if len(f.Polygon) > 2 {
+		poly, ok := unwrapPolygon(f.Polygon)
+		bound := boundingRect(poly)
+		if !ok || bound.Max.Lng-bound.Min.Lng >= 360 {
+			// the polygon encircles a pole
+			bound.Min.Lng, bound.Max.Lng = -180, 180
+			if bound.Min.Lat+bound.Max.Lat >= 0 {
+				bound.Max.Lat = 90
+			} else {
+				bound.Min.Lat = -90
+			}
+			cf.area = &bound
+			return cf
+		}
+		cf.poly = poly
+		cf.minLng, cf.maxLng = bound.Min.Lng, bound.Max.Lng
+		bound.Min.Lng = normalizeLng(bound.Min.Lng)
+		bound.Max.Lng = normalizeLng(bound.Max.Lng)
+		if bound.Max.Lng == -180 {
+			bound.Max.Lng = 180
+		}
+		cf.area = &bound
+	} else if f.Rect != nil {
+		r := f.Rect.normalized()
+		cf.area = &r
+	}
+	return cf
+}
+
+// polyLng shifts the longitude into the unwrapped range of the polygon
+func (cf compiledFilter) polyLng(lng float64) float64 {
+	lng = normalizeLng(lng)
+	if lng < cf.minLng {
+		return lng + 360
+	}
+	if lng > cf.maxLng {
+		return lng - 360
+	}
+	return lng
+}
+
+func (cf compiledFilter) containsPoint(pt vatspydata.Point) bool {
+	if cf.poly != nil {
+		return cf.area.Contains(pt) && pointInPolygon(vatspydata.Point{Lat: pt.Lat, Lng: cf.polyLng(pt.Lng)}, cf.poly)
+	}
+	if cf.area != nil {
+		return cf.area.Contains(pt)
+	}
+	return true
+}
+
+func (cf compiledFilter) match(upd pubsub.Update) bool {
+	if cf.types.Size() > 0 && !cf.types.Has(upd.OType) {
+		return false
+	}
+	switch obj := upd.Obj.(type) {
+	case Airport:
+		return cf.containsPoint(obj.Meta.Position)
+	case Pilot:
+		return cf.containsPoint(pilotPosition(obj))
+	case Radar:
+		return cf.intersectsFIRs(obj.FIRs)
+	case FSS:
+		return cf.intersectsFIRs(obj.FIRs)
+	case Controller:
+		if obj.Position != nil {
+			return cf.containsPoint(*obj.Position)
+		}
+		if len(obj.Bounds) > 0 {
+			return cf.intersectsBounds(obj.Bounds)
+		}
+		// unresolved radar, there's no position to match against
+		return cf.area == nil
+	case UnresolvedRadar:
+		// there's no position to match against
+		return cf.area == nil
+	}
+	return true
+}
+
+func (cf compiledFilter) intersectsFIRs(firs map[string]vatspydata.FIR) bool {
+	if cf.area == nil {
+		return true
+	}
+	for _, fir := range firs {
+		if !cf.area.Intersects(Rect{Min: fir.Boundaries.Min, Max: fir.Boundaries.Max}) {
+			continue
+		}
+		if cf.poly == nil {
+			return true
+		}
+		for _, poly := range fir.Boundaries.Points {
+			if cf.intersectsPolygon(poly) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (cf compiledFilter) intersectsBounds(bounds []Rect) bool {
+	if cf.area == nil {
+		return true
+	}
+	for _, b := range bounds {
+		if !cf.area.Intersects(b) {
+			continue
+		}
+		if cf.poly == nil || cf.intersectsPolygon(b.polygon()) {
+			return true
+		}
+	}
+	return false
+}
+
+// intersectsPolygon checks the filter polygon against a polygon in
+// [-180, 180] range, the filter one may stick out of it on either side
+func (cf compiledFilter) intersectsPolygon(poly []vatspydata.Point) bool {
+	for _, dLng := range []float64{0, -360, 360} {
+		if polygonsIntersect(cf.poly, shiftPolygon(poly, dLng)) {
+			return true
+		}
+	}
+	return false
+}
+
+func keyOf(upd pubsub.Update) (objectKey, bool) {
+	switch obj := upd.Obj.(type) {
+	case Airport:
+		return objectKey{upd.OType, obj.Meta.ICAO}, true
+	case Pilot:
+		return objectKey{upd.OType, obj.Callsign}, true
+	case Radar:
+		return objectKey{upd.OType, obj.Controller.Callsign}, true
+	case FSS:
+		return objectKey{upd.OType, obj.Controller.Callsign}, true
+	case Controller:
+		return objectKey{upd.OType, obj.Callsign}, true
+	case UnresolvedRadar:
+		return objectKey{upd.OType, obj.Controller.Callsign}, true
+	}
+	return objectKey{}, false
+}
+
+// SubscribeFiltered creates a subscription forwarding only updates matching the filter
+func (p *Provider) SubscribeFiltered(chSize int, filter Filter) *FilteredSubscription {
+	fs := &FilteredSubscription{
+		sub:      p.Subscribe(chSize),
+		ch:       make(chan pubsub.Update, chSize),
+		filterCh: make(chan Filter, 1),
+		done:     make(chan bool),
+	}
+	go fs.loop(compileFilter(filter))
+	return fs
+}
+
+// UnsubscribeFiltered stops the filtered subscription and closes its channel
+func (p *Provider) UnsubscribeFiltered(fs *FilteredSubscription) {
+	fs.once.Do(func() {
+		close(fs.done)
+		p.Unsubscribe(fs.sub)
+	})
+}
+
+func (fs *FilteredSubscription) Updates() <-chan pubsub.Update {
+	return fs.ch
+}
+
+func (fs *FilteredSubscription) ID() string {
+	return fs.sub.ID()
+}
+
+// SetFilter replaces the filter on a live subscription. Objects which
+// are no longer matching are deleted, newly matching objects are set.
+// The resulting updates are followed by a Fin update, the same way the
+// initial snapshot of a subscription is, so a client can tell when its
+// view is consistent with the new filter.
+//
+// SetFilter never blocks, so it's safe to call it from the goroutine
+// reading Updates. If the previous filter hasn't been applied yet
+// it's replaced by the new one.
+func (fs *FilteredSubscription) SetFilter(filter Filter) {
+	fs.filterLock.Lock()
+	defer fs.filterLock.Unlock()
+	for {
+		select {
+		case fs.filterCh <- filter:
+			return
+		case <-fs.done:
+			return
+		default:
+		}
+		// drop the pending filter, the newest one wins
+		select {
+		case <-fs.filterCh:
+		default:
+		}
+	}
+}
+
+func (fs *FilteredSubscription) send(upd pubsub.Update) {
+	select {
+	case fs.ch <- upd:
+	case <-fs.done:
+	}
+}
+
+func (fs *FilteredSubscription) loop(cf compiledFilter) {
+	defer close(fs.ch)
+
+	// The subscription keeps its own copy of every object it has seen.
+	// Taking provider's dataLock here could deadlock as the provider
+	// notifies subscribers while holding the lock.
+	objects := make(map[objectKey]pubsub.Update)
+	visible := set.New[objectKey]()
+
+	for {
+		select {
+		case upd, ok := <-fs.sub.Updates():
+			if !ok {
+				return
+			}
+			key, positional := keyOf(upd)
+			if !positional {
+				if upd.UType == pubsub.UpdateTypeFin || cf.match(upd) {
+					fs.send(upd)
+				}
+				continue
+			}
+
+			switch upd.UType {
+			case pubsub.UpdateTypeSet:
+				objects[key] = upd
+				if cf.match(upd) {
+					visible.Add(key)
+					fs.send(upd)
+				} else if visible.Has(key) {
+					visible.Delete(key)
+					fs.send(pubsub.Update{UType: pubsub.UpdateTypeDelete, OType: upd.OType, Obj: upd.Obj})
+				}
+			case pubsub.UpdateTypeDelete:
+				delete(objects, key)
+				if visible.Has(key) {
+					visible.Delete(key)
+					fs.send(upd)
+				}
+			}
+
+		case filter := <-fs.filterCh:
+			cf = compileFilter(filter)
+			for key, upd := range objects {
+				matching := cf.match(upd)
+				if matching && !visible.Has(key) {
+					visible.Add(key)
+					fs.send(upd)
+				} else if !matching && visible.Has(key) {
+					visible.Delete(key)
+					fs.send(pubsub.Update{UType: pubsub.UpdateTypeDelete, OType: upd.OType, Obj: upd.Obj})
+				}
+			}
+			fs.send(pubsub.Update{UType: pubsub.UpdateTypeFin, OType: pubsub.ObjectTypeNone})
+
+		case <-fs.done:
+			// keep draining until provider closes the channel on unsubscribe
+			// so a concurrent Notify is never blocked by us
+			go func() {
+				for range fs.sub.Updates() {
+				}
+			}()
+			return
+		}
+	}
+}
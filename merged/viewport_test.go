@@ -0,0 +1,291 @@
+package merged
+
+import (
+	"testing"
+	"time"
+
+	vatsimapi "github.com/vatsimnerd/simwatch-providers/vatsim-api"
+	vatspydata "github.com/vatsimnerd/simwatch-providers/vatspy-data"
+	"github.com/vatsimnerd/util/pubsub"
+)
+
+func expectUpdate(t *testing.T, fs *FilteredSubscription, uType pubsub.UpdateType, callsign string) {
+	t.Helper()
+	select {
+	case upd := <-fs.Updates():
+		pilot, ok := upd.Obj.(Pilot)
+		if upd.UType != uType || !ok || pilot.Callsign != callsign {
+			t.Errorf("expected update %v for %s, got %v", uType, callsign, upd)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("expected update %v for %s, got nothing", uType, callsign)
+	}
+}
+
+func expectNoUpdate(t *testing.T, fs *FilteredSubscription) {
+	t.Helper()
+	select {
+	case upd := <-fs.Updates():
+		t.Errorf("unexpected update %v", upd)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestFilteredSubscription(t *testing.T) {
+	p := New(nil, nil, nil)
+	europe := Rect{Min: vatspydata.Point{Lat: 35, Lng: -10}, Max: vatspydata.Point{Lat: 60, Lng: 30}}
+	fs := p.SubscribeFiltered(16, Filter{Rect: &europe, Types: []pubsub.ObjectType{ObjectTypePilot}})
+	defer p.UnsubscribeFiltered(fs)
+
+	p.setPilot(vatsimapi.Pilot{Callsign: "AFR123", Latitude: 49, Longitude: 2.5})
+	expectUpdate(t, fs, pubsub.UpdateTypeSet, "AFR123")
+
+	p.setPilot(vatsimapi.Pilot{Callsign: "UAL1", Latitude: 40, Longitude: -73})
+	expectNoUpdate(t, fs)
+
+	// moving out of the area
+	p.setPilot(vatsimapi.Pilot{Callsign: "AFR123", Latitude: 45, Longitude: -20})
+	expectUpdate(t, fs, pubsub.UpdateTypeDelete, "AFR123")
+
+	// moving the viewport over the atlantic
+	atlantic := Rect{Min: vatspydata.Point{Lat: 30, Lng: -80}, Max: vatspydata.Point{Lat: 60, Lng: -15}}
+	fs.SetFilter(Filter{Rect: &atlantic})
+	got := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		select {
+		case upd := <-fs.Updates():
+			if upd.UType != pubsub.UpdateTypeSet {
+				t.Errorf("expected set update, got %v", upd)
+				continue
+			}
+			got[upd.Obj.(Pilot).Callsign] = true
+		case <-time.After(time.Second):
+			t.Fatal("expected set update, got nothing")
+		}
+	}
+	if !got["AFR123"] || !got["UAL1"] {
+		t.Errorf("expected AFR123 and UAL1 to be set, got %v", got)
+	}
+	select {
+	case upd := <-fs.Updates():
+		if upd.UType != pubsub.UpdateTypeFin {
+			t.Errorf("expected fin update after the filter change, got %v", upd)
+		}
+	case <-time.After(time.Second):
+		t.Error("expected fin update after the filter change, got nothing")
+	}
+}
+
+func TestPolygonFilter(t *testing.T) {
+	pt := func(lat, lng float64) vatspydata.Point {
+		return vatspydata.Point{Lat: lat, Lng: lng}
+	}
+	// triangle which bounding box covers most of western europe
+	triangle := []vatspydata.Point{pt(40, 0), pt(60, 0), pt(60, 20)}
+	// pacific box crossing the antimeridian
+	pacific := []vatspydata.Point{pt(-50, 160), pt(-10, 160), pt(-10, -160), pt(-50, -160)}
+	// arctic ring around the north pole
+	arctic := []vatspydata.Point{pt(70, 0), pt(70, 90), pt(70, 180), pt(70, -90)}
+
+	testcases := []struct {
+		name string
+		poly []vatspydata.Point
+		pt   vatspydata.Point
+		exp  bool
+	}{
+		{"inside triangle", triangle, pt(55, 5), true},
+		{"inside triangle bbox only", triangle, pt(45, 15), false},
+		{"pacific west side", pacific, pt(-30, 170), true},
+		{"pacific east side", pacific, pt(-30, -170), true},
+		{"pacific denormalized lng", pacific, pt(-30, 190), true},
+		{"pacific on antimeridian", pacific, pt(-30, 180), true},
+		{"pacific outside", pacific, pt(-30, 150), false},
+		{"pacific across the globe", pacific, pt(-30, 0), false},
+		{"arctic", arctic, pt(80, 45), true},
+		{"arctic other side", arctic, pt(75, -135), true},
+		{"south of arctic", arctic, pt(60, 45), false},
+	}
+
+	for _, tc := range testcases {
+		cf := compileFilter(Filter{Polygon: tc.poly})
+		if cf.containsPoint(tc.pt) != tc.exp {
+			t.Errorf("%s: expected containsPoint(%v) to be %v", tc.name, tc.pt, tc.exp)
+		}
+	}
+}
+
+func TestPolygonFilterRadars(t *testing.T) {
+	pt := func(lat, lng float64) vatspydata.Point {
+		return vatspydata.Point{Lat: lat, Lng: lng}
+	}
+	firs := func(fir vatspydata.FIR) map[string]vatspydata.FIR {
+		return map[string]vatspydata.FIR{fir.ID: fir}
+	}
+	triangle := []vatspydata.Point{pt(40, 0), pt(60, 0), pt(60, 20)}
+	pacific := []vatspydata.Point{pt(-50, 160), pt(-10, 160), pt(-10, -160), pt(-50, -160)}
+
+	testcases := []struct {
+		name string
+		poly []vatspydata.Point
+		fir  vatspydata.FIR
+		exp  bool
+	}{
+		{"fir inside", triangle, makeTestFIR("EDWW", rectPoly(52, 5, 54, 7)), true},
+		{"fir containing filter", triangle, makeTestFIR("EURO", rectPoly(30, -10, 70, 30)), true},
+		{"fir crossing an edge", triangle, makeTestFIR("EDMM", rectPoly(48, 8, 52, 12)), true},
+		{"fir in bbox only", triangle, makeTestFIR("LIRR", rectPoly(41, 14, 44, 18)), false},
+		{"fir west of antimeridian", pacific, makeTestFIR("NFFF", rectPoly(-25, 170, -15, 178)), true},
+		{"fir east of antimeridian", pacific, makeTestFIR("NCRG", rectPoly(-25, -170, -15, -165)), true},
+		{"fir outside", pacific, makeTestFIR("YBBB", rectPoly(-30, 140, -20, 150)), false},
+	}
+
+	for _, tc := range testcases {
+		cf := compileFilter(Filter{Polygon: tc.poly})
+		if cf.match(pubsub.Update{UType: pubsub.UpdateTypeSet, OType: ObjectTypeRadar, Obj: Radar{FIRs: firs(tc.fir)}}) != tc.exp {
+			t.Errorf("%s: expected radar match to be %v", tc.name, tc.exp)
+		}
+	}
+}
+
+func controllerUpdates(t *testing.T, fs *FilteredSubscription) map[string]pubsub.UpdateType {
+	t.Helper()
+	got := make(map[string]pubsub.UpdateType)
+	for {
+		select {
+		case upd := <-fs.Updates():
+			if ctrl, ok := upd.Obj.(Controller); ok {
+				got[ctrl.Callsign] = upd.UType
+			}
+		case <-time.After(50 * time.Millisecond):
+			return got
+		}
+	}
+}
+
+func TestFilteredControllers(t *testing.T) {
+	p := New(nil, nil, nil)
+	p.setAirport(vatspydata.AirportMeta{ICAO: "EGLL", IATA: "LHR", Position: vatspydata.Point{Lat: 51.4775, Lng: -0.4614}})
+	p.setAirport(vatspydata.AirportMeta{ICAO: "KJFK", IATA: "JFK", Position: vatspydata.Point{Lat: 40.6398, Lng: -73.7789}})
+	p.setFIR(makeTestFIR("EDWW", rectPoly(50, 5, 56, 15)))
+	p.setFIR(makeTestFIR("KZNY", rectPoly(38, -75, 42, -70)))
+
+	europe := Rect{Min: vatspydata.Point{Lat: 35, Lng: -10}, Max: vatspydata.Point{Lat: 60, Lng: 30}}
+	fs := p.SubscribeFiltered(16, Filter{Rect: &europe, Types: []pubsub.ObjectType{ObjectTypeController}})
+	defer p.UnsubscribeFiltered(fs)
+
+	for _, c := range []vatsimapi.Controller{
+		{Callsign: "EGLL_TWR", Facility: vatsimapi.FacilityTower},
+		{Callsign: "KJFK_TWR", Facility: vatsimapi.FacilityTower},
+		{Callsign: "EDWW_CTR", Facility: vatsimapi.FacilityRadar},
+		{Callsign: "KZNY_CTR", Facility: vatsimapi.FacilityRadar},
+		{Callsign: "ZZZZ_CTR", Facility: vatsimapi.FacilityRadar},
+	} {
+		p.setController(c)
+	}
+
+	testcases := []struct {
+		name   string
+		filter *Rect
+		exp    map[string]pubsub.UpdateType
+	}{
+		{
+			"europe",
+			nil,
+			map[string]pubsub.UpdateType{"EGLL_TWR": pubsub.UpdateTypeSet, "EDWW_CTR": pubsub.UpdateTypeSet},
+		},
+		{
+			"new york",
+			&Rect{Min: vatspydata.Point{Lat: 35, Lng: -80}, Max: vatspydata.Point{Lat: 45, Lng: -65}},
+			map[string]pubsub.UpdateType{
+				"EGLL_TWR": pubsub.UpdateTypeDelete,
+				"EDWW_CTR": pubsub.UpdateTypeDelete,
+				"KJFK_TWR": pubsub.UpdateTypeSet,
+				"KZNY_CTR": pubsub.UpdateTypeSet,
+			},
+		},
+	}
+
+	for _, tc := range testcases {
+		if tc.filter != nil {
+			fs.SetFilter(Filter{Rect: tc.filter, Types: []pubsub.ObjectType{ObjectTypeController}})
+		}
+		got := controllerUpdates(t, fs)
+		if len(got) != len(tc.exp) {
+			t.Errorf("%s: expected updates %v, got %v", tc.name, tc.exp, got)
+			continue
+		}
+		for callsign, uType := range tc.exp {
+			if got[callsign] != uType {
+				t.Errorf("%s: expected updates %v, got %v", tc.name, tc.exp, got)
+				break
+			}
+		}
+	}
+
+	// tower leaving the area with its airport being moved
+	p.setAirport(vatspydata.AirportMeta{ICAO: "KJFK", IATA: "JFK", Position: vatspydata.Point{Lat: 51, Lng: 0}})
+	p.setController(vatsimapi.Controller{Callsign: "KJFK_TWR", Facility: vatsimapi.FacilityTower, Frequency: 119100})
+	if got := controllerUpdates(t, fs); got["KJFK_TWR"] != pubsub.UpdateTypeDelete {
+		t.Errorf("expected KJFK_TWR to be deleted, got %v", got)
+	}
+}
+
+func TestSetFilterWithFullBuffer(t *testing.T) {
+	p := New(nil, nil, nil)
+	fs := p.SubscribeFiltered(1, Filter{Types: []pubsub.ObjectType{ObjectTypePilot}})
+	defer p.UnsubscribeFiltered(fs)
+
+	callsigns := []string{"AFR1", "AFR2", "AFR3"}
+	go func() {
+		for _, callsign := range callsigns {
+			p.setPilot(vatsimapi.Pilot{Callsign: callsign, Latitude: 49, Longitude: 2.5})
+		}
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for len(fs.Updates()) < cap(fs.Updates()) {
+		if time.Now().After(deadline) {
+			t.Fatal("subscription buffer is expected to be filled")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// the client calls SetFilter from the goroutine reading updates
+	// while the subscription is blocked sending to it
+	europe := Rect{Min: vatspydata.Point{Lat: 35, Lng: -10}, Max: vatspydata.Point{Lat: 60, Lng: 30}}
+	pacific := Rect{Min: vatspydata.Point{Lat: -50, Lng: 160}, Max: vatspydata.Point{Lat: -10, Lng: -160}}
+	set := make(chan bool)
+	go func() {
+		fs.SetFilter(Filter{Rect: &europe, Types: []pubsub.ObjectType{ObjectTypePilot}})
+		fs.SetFilter(Filter{Rect: &pacific, Types: []pubsub.ObjectType{ObjectTypePilot}})
+		close(set)
+	}()
+	select {
+	case <-set:
+	case <-time.After(time.Second):
+		t.Fatal("SetFilter is blocked by the full subscription buffer")
+	}
+
+	// the latest filter wins, all pilots are outside of it
+	visible := make(map[string]bool)
+	for {
+		select {
+		case upd := <-fs.Updates():
+			if pilot, ok := upd.Obj.(Pilot); ok {
+				visible[pilot.Callsign] = upd.UType == pubsub.UpdateTypeSet
+			}
+			continue
+		case <-time.After(100 * time.Millisecond):
+		}
+		break
+	}
+	for callsign, v := range visible {
+		if v {
+			t.Errorf("%s is not expected to be visible with the latest filter", callsign)
+		}
+	}
+	// pilots set after the filter change are never sent
+	if len(visible) == 0 || len(visible) > len(callsigns) {
+		t.Errorf("expected updates for some of %v, got %v", callsigns, visible)
+	}
+}
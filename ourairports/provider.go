@@ -3,14 +3,14 @@ package ourairports
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"fmt"
-	"io/ioutil"
-	"strings"
 	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/vatsimnerd/perfetch"
+	simwatchproviders "github.com/vatsimnerd/simwatch-providers"
 	"github.com/vatsimnerd/util/pubsub"
 )
 
@@ -19,10 +19,12 @@ type Provider struct {
 
 	cfg *Config
 
-	stop    chan bool
-	stopped bool
+	life   *simwatchproviders.Lifecycle
+	health *simwatchproviders.Health
+	cached *simwatchproviders.CacheTracker
 
 	runways map[string]map[string]*Runway
+	source  *simwatchproviders.Source
 
 	dataLock sync.RWMutex
 }
@@ -37,93 +39,117 @@ const (
 	ObjecTypeRunway pubsub.ObjectType = 300 + iota
 )
 
+const (
+	defaultPollPeriod = 24 * time.Hour
+	runwaysCacheName  = "ourairports-runways.csv"
+)
+
 func New(cfg *Config) *Provider {
 	return &Provider{
 		Provider: pubsub.NewProvider(),
 		cfg:      cfg,
-		stop:     make(chan bool),
-		stopped:  false,
+		life:     simwatchproviders.NewLifecycle(),
+		health:   simwatchproviders.NewHealth(),
+		cached:   simwatchproviders.NewCacheTracker(),
 		runways:  make(map[string]map[string]*Runway),
 	}
 }
 
-func (p *Provider) Start() error {
-	if p.stopped {
-		return fmt.Errorf("can't start once stopped provider")
-	}
-	go p.loop()
-	return nil
+// Start runs the provider loop until ctx is done or the provider is
+// stopped. It blocks until the initial runways are loaded or ctx is done.
+func (p *Provider) Start(ctx context.Context) error {
+	return p.life.Start(ctx, p.loop)
 }
 
+// Stop stops the provider and waits for its loop and poller to finish
 func (p *Provider) Stop() {
-	p.stop <- true
+	p.life.Stop()
 }
 
-func (p *Provider) loop() {
+// Done returns a channel which is closed once the provider is stopped
+func (p *Provider) Done() <-chan struct{} {
+	return p.life.Done()
+}
+
+func (p *Provider) pollPeriod() time.Duration {
+	if p.cfg == nil || p.cfg.Poll.Period <= 0 {
+		// local files used to be read once with no poll period configured
+		return defaultPollPeriod
+	}
+	return p.cfg.Poll.Period
+}
+
+func (p *Provider) loop(ctx context.Context, booted chan<- error) {
 	defer p.Dispose()
 
-	var rawChan <-chan []byte
-
-	if strings.HasPrefix(p.cfg.URL, "http") {
-		poller := perfetch.New(
-			p.cfg.Poll.Period,
-			perfetch.HTTPGetFetcher(p.cfg.URL, p.cfg.Poll.Timeout),
-		)
-		psub := poller.Subscribe(1024)
-		defer poller.Unsubscribe(psub)
-
-		p.SetInitialNotifier(func(sub pubsub.Subscription) {
-			// make notifier async to avoid reaching chan buffer limit
-			go func() {
-				p.dataLock.RLock()
-				defer p.dataLock.RUnlock()
-				for _, rwmap := range p.runways {
-					for _, rwy := range rwmap {
-						update := pubsub.Update{
-							UType: pubsub.UpdateTypeSet,
-							OType: ObjecTypeRunway,
-							Obj:   *rwy,
-						}
-						p.Notify(update)
+	source, err := simwatchproviders.NewSource(p.cfg.URL, p.cfg.Poll.Timeout)
+	if err != nil {
+		log.WithError(err).Error("error creating runways source")
+		booted <- fmt.Errorf("error creating runways source: %w", err)
+		return
+	}
+	p.dataLock.Lock()
+	p.source = source
+	p.dataLock.Unlock()
+	p.cached.SetCache(simwatchproviders.NewCache(p.cfg.Boot.CacheDir))
+
+	poller := perfetch.New(p.pollPeriod(), simwatchproviders.SkipFirst(p.health.Track(source.Fetcher())))
+	psub := poller.Subscribe(1024)
+
+	p.SetInitialNotifier(func(sub pubsub.Subscription) {
+		// make notifier async to avoid reaching chan buffer limit
+		go func() {
+			p.dataLock.RLock()
+			defer p.dataLock.RUnlock()
+			for _, rwmap := range p.runways {
+				for _, rwy := range rwmap {
+					update := pubsub.Update{
+						UType: pubsub.UpdateTypeSet,
+						OType: ObjecTypeRunway,
+						Obj:   *rwy,
 					}
+					p.Notify(update)
 				}
-				p.Fin()
-			}()
-		})
-
-		r := 0
-		for r < p.cfg.Boot.Retries {
-			err := poller.Start()
-			if err == nil {
-				break
 			}
-			r++
-			log.WithError(err).WithField("retries_left", p.cfg.Boot.Retries-r).Error("error fetching runways (initial)")
-			if r == p.cfg.Boot.Retries {
-				log.Fatal("error fetching runways (initially), no retries left")
-			}
-			time.Sleep(p.cfg.Boot.RetryCooldown)
-		}
-		defer poller.Stop()
+			p.Fin()
+		}()
+	})
+
+	raw, stale, err := simwatchproviders.Boot(ctx, runwaysCacheName, p.health.Track(source.Fetch), p.cfg.Boot, p.cached.Cache())
+	if err != nil {
+		log.WithError(err).Error("error fetching runways (initially)")
+		booted <- fmt.Errorf("error fetching runways: %w", err)
+		return
+	}
+	p.parseRunways(raw)
+	p.cached.Parsed(runwaysCacheName, raw, stale)
+	if !stale {
+		p.health.Success()
+	}
 
-		rawChan = psub.Updates()
-	} else {
-		data, err := ioutil.ReadFile(p.cfg.URL)
-		if err != nil {
-			log.WithError(err).WithField("filename", p.cfg.URL).Fatal("error loading file")
-		}
-		ch := make(chan []byte, 1)
-		ch <- data
-		rawChan = ch
+	// the initial payload is already fetched on boot so
+	// the first poll is skipped
+	if err := poller.Start(); err != nil {
+		log.WithError(err).Error("error starting runways poller")
+		booted <- fmt.Errorf("error starting runways poller: %w", err)
+		return
 	}
+	defer simwatchproviders.StopPoller(poller, psub)
+	booted <- nil
 
 loop:
 	for {
 		select {
-		case raw := <-rawChan:
+		case raw := <-psub.Updates():
+			if raw == nil {
+				// not modified
+				continue
+			}
 			log.Debug("got update from ourairport poller")
 			p.parseRunways(raw)
-		case <-p.stop:
+			p.cached.Parsed(runwaysCacheName, raw, false)
+			p.health.Success()
+		case <-ctx.Done():
 			break loop
 		}
 	}
@@ -174,3 +200,31 @@ func (p *Provider) parseRunways(data []byte) {
 	p.Fin()
 	p.SetDataReady(true)
 }
+
+// Status reports the provider health
+func (p *Provider) Status() simwatchproviders.Status {
+	p.dataLock.RLock()
+	count := 0
+	for _, rwmap := range p.runways {
+		count += len(rwmap)
+	}
+	p.dataLock.RUnlock()
+	objects := map[string]int{"runways": count}
+	return p.health.Status("ourairports", p.life, p.pollPeriod(), p.IsStale(), objects)
+}
+
+// SourceStatus reports when runways source has been checked and changed
+func (p *Provider) SourceStatus() []simwatchproviders.SourceStatus {
+	p.dataLock.RLock()
+	defer p.dataLock.RUnlock()
+	if p.source == nil {
+		return []simwatchproviders.SourceStatus{}
+	}
+	return []simwatchproviders.SourceStatus{p.source.Status()}
+}
+
+// IsStale returns true if runways have been loaded from the cache
+// and haven't been refreshed from the source yet
+func (p *Provider) IsStale() bool {
+	return p.cached.IsStale()
+}
@@ -0,0 +1,181 @@
+package simwatchproviders
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/sirupsen/logrus"
+	"github.com/vatsimnerd/perfetch"
+)
+
+// Fetcher returns a raw payload every time it's called by a poller
+type Fetcher = perfetch.Fetcher[[]byte]
+
+var (
+	log = logrus.WithField("module", "simwatchproviders")
+
+	memSources     = make(map[string][]byte)
+	memSourcesLock sync.RWMutex
+
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// NewFetcher creates a fetcher by the source URL scheme:
+//
+//	http://, https://  - HTTP GET request
+//	file://path        - local file, re-read on every poll
+//	mem://name         - in-memory source set with SetMemSource
+//
+// A URL without a scheme is treated as a local file path.
+// Gzip and zstd compressed payloads are decompressed transparently.
+func NewFetcher(sourceURL string, timeout time.Duration) (Fetcher, error) {
+	u, err := url.Parse(sourceURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var fetch Fetcher
+	switch u.Scheme {
+	case "http", "https":
+		fetch = httpFetcher(sourceURL, timeout)
+	case "file":
+		// file://relative/path is parsed with the first path item as a host
+		fetch = fileFetcher(u.Host + u.Path)
+	case "":
+		fetch = fileFetcher(sourceURL)
+	case "mem":
+		fetch = memFetcher(u.Host + u.Path)
+	default:
+		return nil, fmt.Errorf("unsupported source scheme '%s'", u.Scheme)
+	}
+
+	return func() ([]byte, error) {
+		data, err := fetch()
+		if err != nil {
+			return nil, err
+		}
+		return decompress(data)
+	}, nil
+}
+
+func httpFetcher(sourceURL string, timeout time.Duration) Fetcher {
+	return func() ([]byte, error) {
+		data, _, err := httpGet(sourceURL, timeout, nil)
+		return data, err
+	}
+}
+
+// httpGet runs a GET request with extra headers. The response is returned
+// for its headers only, the body is already read and closed.
+func httpGet(sourceURL string, timeout time.Duration, header http.Header) ([]byte, *http.Response, error) {
+	flog := log.WithField("url", sourceURL)
+	flog.Debug("running http fetcher")
+
+	req, err := http.NewRequest(http.MethodGet, sourceURL, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	cli := &http.Client{Timeout: timeout}
+	resp, err := cli.Do(req)
+	if err != nil {
+		flog.WithError(err).Error("error getting HTTP response")
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, resp, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		err = fmt.Errorf("unexpected HTTP status %s", resp.Status)
+		flog.WithError(err).Error("error getting HTTP response")
+		return nil, resp, err
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		flog.WithError(err).Error("error reading HTTP response body")
+	}
+	return data, resp, err
+}
+
+func fileFetcher(filename string) Fetcher {
+	return func() ([]byte, error) {
+		log.WithField("filename", filename).Debug("running file fetcher")
+		return os.ReadFile(filename)
+	}
+}
+
+func memFetcher(name string) Fetcher {
+	return func() ([]byte, error) {
+		memSourcesLock.RLock()
+		defer memSourcesLock.RUnlock()
+		data, found := memSources[name]
+		if !found {
+			return nil, fmt.Errorf("memory source '%s' is not set", name)
+		}
+		return data, nil
+	}
+}
+
+// SetMemSource sets the payload returned by mem://name sources.
+// It's useful in tests and with data embedded into the binary.
+func SetMemSource(name string, data []byte) {
+	memSourcesLock.Lock()
+	defer memSourcesLock.Unlock()
+	memSources[name] = data
+}
+
+func DeleteMemSource(name string) {
+	memSourcesLock.Lock()
+	defer memSourcesLock.Unlock()
+	delete(memSources, name)
+}
+
+// SkipFirst wraps a fetcher so its first call returns a nil payload
+// without fetching anything. Pollers fetch as soon as they are started,
+// it saves a request for the payload which has just been fetched on boot.
+func SkipFirst(fetch Fetcher) Fetcher {
+	var once sync.Once
+	return func() ([]byte, error) {
+		skip := false
+		once.Do(func() { skip = true })
+		if skip {
+			return nil, nil
+		}
+		return fetch()
+	}
+}
+
+func decompress(data []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, gzipMagic):
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return io.ReadAll(zr)
+	case bytes.HasPrefix(data, zstdMagic):
+		zr, err := zstd.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return io.ReadAll(zr)
+	}
+	return data, nil
+}
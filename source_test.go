@@ -0,0 +1,164 @@
+package simwatchproviders
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func gzipped(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zstded(t *testing.T, data []byte) []byte {
+	zw, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zw.Close()
+	return zw.EncodeAll(data, nil)
+}
+
+func TestFetchers(t *testing.T) {
+	payload := []byte(`{"general":{}}`)
+	dir := t.TempDir()
+	plain := filepath.Join(dir, "data.json")
+	compressed := filepath.Join(dir, "data.json.gz")
+	if err := os.WriteFile(plain, payload, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(compressed, gzipped(t, payload), 0644); err != nil {
+		t.Fatal(err)
+	}
+	SetMemSource("test/data", zstded(t, payload))
+	defer DeleteMemSource("test/data")
+
+	for _, src := range []string{plain, "file://" + plain, "file://" + compressed, "mem://test/data"} {
+		fetch, err := NewFetcher(src, 0)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", src, err)
+			continue
+		}
+		data, err := fetch()
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", src, err)
+			continue
+		}
+		if !bytes.Equal(data, payload) {
+			t.Errorf("%s: expected %s, got %s", src, payload, data)
+		}
+	}
+
+	if _, err := NewFetcher("ftp://example.com/data.json", 0); err == nil {
+		t.Error("expected unsupported scheme error")
+	}
+	fetch, _ := NewFetcher("mem://missing", 0)
+	if _, err := fetch(); err == nil {
+		t.Error("expected missing memory source error")
+	}
+}
+
+func TestSourceConditional(t *testing.T) {
+	payload := []byte("ICAO|Name")
+	requests := 0
+	notModified := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write(payload)
+	}))
+	defer srv.Close()
+
+	src, err := NewSource(srv.URL, time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := src.Fetch()
+	if err != nil || !bytes.Equal(data, payload) {
+		t.Fatalf("expected %s, got %s (%v)", payload, data, err)
+	}
+	changed := src.Status().LastChanged
+
+	data, err = src.Fetch()
+	if err != nil || data != nil {
+		t.Errorf("expected nil payload on 304, got %s (%v)", data, err)
+	}
+	if notModified != 1 {
+		t.Errorf("expected conditional request to be sent, got %d requests", requests)
+	}
+	status := src.Status()
+	if status.LastChanged != changed || status.LastChecked.Before(changed) {
+		t.Errorf("unexpected status %+v", status)
+	}
+}
+
+func TestSourceSameContent(t *testing.T) {
+	SetMemSource("test/same", []byte("a"))
+	defer DeleteMemSource("test/same")
+
+	src, _ := NewSource("mem://test/same", 0)
+	if data, _ := src.Fetch(); data == nil {
+		t.Error("expected first fetch to return payload")
+	}
+	if data, _ := src.Fetch(); data != nil {
+		t.Errorf("expected unchanged content to be skipped, got %s", data)
+	}
+	SetMemSource("test/same", []byte("b"))
+	if data, _ := src.Fetch(); string(data) != "b" {
+		t.Errorf("expected changed content, got %s", data)
+	}
+}
+
+func TestSourceInvalidate(t *testing.T) {
+	SetMemSource("test/invalid", []byte("a"))
+	defer DeleteMemSource("test/invalid")
+
+	src, _ := NewSource("mem://test/invalid", 0)
+	src.Fetch()
+	src.Invalidate()
+	if data, _ := src.Fetch(); string(data) != "a" {
+		t.Errorf("expected invalidated payload to be returned again, got %s", data)
+	}
+	if data, _ := src.Fetch(); data != nil {
+		t.Errorf("expected unchanged content to be skipped, got %s", data)
+	}
+}
+
+func TestSkipFirst(t *testing.T) {
+	calls := 0
+	fetch := SkipFirst(func() ([]byte, error) {
+		calls++
+		return []byte("payload"), nil
+	})
+
+	for i, exp := range []string{"", "payload", "payload"} {
+		data, err := fetch()
+		if err != nil || string(data) != exp || (exp == "") != (data == nil) {
+			t.Errorf("call %d: expected '%s', got '%s', error %v", i, exp, data, err)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 calls of the wrapped fetcher, got %d", calls)
+	}
+}
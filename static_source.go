@@ -0,0 +1,125 @@
+package simwatchproviders
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+type (
+	// SourceStatus tells when a source has been checked and
+	// when its content has changed for the last time
+	SourceStatus struct {
+		URL         string    `json:"url"`
+		LastChecked time.Time `json:"last_checked"`
+		LastChanged time.Time `json:"last_changed"`
+	}
+
+	// Source is a fetcher for rarely changing data. It sends conditional
+	// HTTP requests and compares content hashes so unchanged data
+	// is never returned twice.
+	Source struct {
+		url     string
+		timeout time.Duration
+		isHTTP  bool
+		fetch   Fetcher
+
+		etag         string
+		lastModified string
+		hash         [sha256.Size]byte
+		status       SourceStatus
+
+		lock sync.Mutex
+	}
+)
+
+func NewSource(sourceURL string, timeout time.Duration) (*Source, error) {
+	fetch, err := NewFetcher(sourceURL, timeout)
+	if err != nil {
+		return nil, err
+	}
+	u, _ := url.Parse(sourceURL)
+	return &Source{
+		url:     sourceURL,
+		timeout: timeout,
+		isHTTP:  u.Scheme == "http" || u.Scheme == "https",
+		fetch:   fetch,
+		status:  SourceStatus{URL: sourceURL},
+	}, nil
+}
+
+// Fetch returns the source payload. A nil payload with no error means
+// the source hasn't changed since the previous fetch.
+func (s *Source) Fetch() ([]byte, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var data []byte
+	var err error
+	if s.isHTTP {
+		data, err = s.fetchHTTPUnsafe()
+	} else {
+		data, err = s.fetch()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	s.status.LastChecked = now
+	if data == nil {
+		log.WithField("url", s.url).Debug("source not modified")
+		return nil, nil
+	}
+
+	hash := sha256.Sum256(data)
+	if !s.status.LastChanged.IsZero() && hash == s.hash {
+		log.WithField("url", s.url).Debug("source content is the same")
+		return nil, nil
+	}
+	s.hash = hash
+	s.status.LastChanged = now
+	return data, nil
+}
+
+func (s *Source) fetchHTTPUnsafe() ([]byte, error) {
+	header := make(http.Header)
+	if s.etag != "" {
+		header.Set("If-None-Match", s.etag)
+	}
+	if s.lastModified != "" {
+		header.Set("If-Modified-Since", s.lastModified)
+	}
+
+	data, resp, err := httpGet(s.url, s.timeout, header)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	s.etag = resp.Header.Get("ETag")
+	s.lastModified = resp.Header.Get("Last-Modified")
+	return decompress(data)
+}
+
+// Invalidate forgets the last payload so it's returned again on the
+// next fetch even if unchanged. It's meant for payloads which can't
+// be applied so they are retried and keep being reported as failures.
+func (s *Source) Invalidate() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.etag = ""
+	s.lastModified = ""
+	s.hash = [sha256.Size]byte{}
+}
+
+// Fetcher makes the source usable with a perfetch poller
+func (s *Source) Fetcher() Fetcher {
+	return s.Fetch
+}
+
+func (s *Source) Status() SourceStatus {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.status
+}
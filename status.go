@@ -0,0 +1,127 @@
+package simwatchproviders
+
+import (
+	"sync"
+	"time"
+)
+
+type (
+	// State is a provider lifecycle state
+	State string
+
+	// Status is a provider health report suitable for readiness
+	// and liveness probes
+	Status struct {
+		Name                string         `json:"name"`
+		State               State          `json:"state"`
+		LastSuccess         time.Time      `json:"last_success"`
+		LastError           string         `json:"last_error,omitempty"`
+		ConsecutiveFailures int            `json:"consecutive_failures"`
+		PollPeriod          time.Duration  `json:"poll_period"`
+		Objects             map[string]int `json:"objects"`
+		Children            []Status       `json:"children,omitempty"`
+	}
+
+	// Health tracks fetch and parse results of a provider
+	Health struct {
+		lastSuccess time.Time
+		lastErr     error
+		failures    int
+
+		lock sync.Mutex
+	}
+)
+
+const (
+	StateBooting  State = "booting"
+	StateReady    State = "ready"
+	StateDegraded State = "degraded"
+	StateStale    State = "stale"
+	StateStopped  State = "stopped"
+)
+
+// Ready returns true if the provider serves data, possibly outdated
+func (s Status) Ready() bool {
+	return s.State == StateReady || s.State == StateStale || s.State == StateDegraded
+}
+
+// Alive returns true if the provider loop is running
+func (s Status) Alive() bool {
+	return s.State != StateStopped
+}
+
+func NewHealth() *Health {
+	return &Health{}
+}
+
+// Success records a payload which has been fetched and applied
+func (h *Health) Success() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.lastSuccess = time.Now()
+	h.failures = 0
+}
+
+// Failure records a failed fetch or a payload which can't be parsed
+func (h *Health) Failure(err error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.lastErr = err
+	h.failures++
+}
+
+// Track wraps a fetcher recording its failures. A nil payload means
+// the source hasn't changed since the last applied payload and is
+// recorded as a success, other payloads are recorded by the provider
+// once they are parsed and applied.
+func (h *Health) Track(fetch Fetcher) Fetcher {
+	return func() ([]byte, error) {
+		data, err := fetch()
+		if err != nil {
+			h.Failure(err)
+		} else if data == nil {
+			h.Success()
+		}
+		return data, err
+	}
+}
+
+// Status builds a provider status. A running provider is reported
+// stale if its data is stale and degraded if the last fetch has failed.
+func (h *Health) Status(name string, life *Lifecycle, period time.Duration, stale bool, objects map[string]int) Status {
+	return CombinedStatus(name, life, period, stale, objects, h)
+}
+
+// CombinedStatus builds a status of a provider with several sources
+// each tracked by its own health. LastSuccess is the oldest last
+// success among the sources and the provider is degraded if any
+// source has failed.
+func CombinedStatus(name string, life *Lifecycle, period time.Duration, stale bool, objects map[string]int, hs ...*Health) Status {
+	s := Status{
+		Name:       name,
+		State:      life.State(),
+		PollPeriod: period,
+		Objects:    objects,
+	}
+	for i, h := range hs {
+		h.lock.Lock()
+		if i == 0 || h.lastSuccess.Before(s.LastSuccess) {
+			s.LastSuccess = h.lastSuccess
+		}
+		if h.failures > s.ConsecutiveFailures {
+			s.ConsecutiveFailures = h.failures
+			s.LastError = h.lastErr.Error()
+		} else if s.LastError == "" && h.lastErr != nil {
+			s.LastError = h.lastErr.Error()
+		}
+		h.lock.Unlock()
+	}
+	if s.State == StateReady {
+		if stale {
+			s.State = StateStale
+		} else if s.ConsecutiveFailures > 0 {
+			s.State = StateDegraded
+		}
+	}
+	return s
+}
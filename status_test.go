@@ -0,0 +1,86 @@
+package simwatchproviders
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestHealthStatus(t *testing.T) {
+	h := NewHealth()
+	l := NewLifecycle()
+	if st := h.Status("test", l, 0, false, nil); st.State != StateStopped {
+		t.Errorf("expected %s state before start, got %s", StateStopped, st.State)
+	}
+
+	err := l.Start(context.Background(), func(ctx context.Context, booted chan<- error) {
+		booted <- nil
+		<-ctx.Done()
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer l.Stop()
+
+	failing := h.Track(func() ([]byte, error) { return nil, fmt.Errorf("unreachable") })
+	fetched := h.Track(func() ([]byte, error) { return []byte("payload"), nil })
+	unchanged := h.Track(func() ([]byte, error) { return nil, nil })
+
+	fetched()
+	if st := h.Status("test", l, 0, false, nil); !st.LastSuccess.IsZero() {
+		t.Errorf("expected no success until the payload is applied, got %+v", st)
+	}
+	h.Success()
+	if st := h.Status("test", l, 0, false, nil); st.State != StateReady || st.LastSuccess.IsZero() {
+		t.Errorf("expected %s state with last success, got %+v", StateReady, st)
+	}
+
+	failing()
+	failing()
+	st := h.Status("test", l, 0, false, nil)
+	if st.State != StateDegraded || st.ConsecutiveFailures != 2 || st.LastError != "unreachable" {
+		t.Errorf("expected %s state with 2 failures, got %+v", StateDegraded, st)
+	}
+	if st := h.Status("test", l, 0, true, nil); st.State != StateStale {
+		t.Errorf("expected %s state, got %s", StateStale, st.State)
+	}
+
+	// a payload which can't be applied keeps the provider degraded
+	fetched()
+	h.Failure(fmt.Errorf("invalid payload"))
+	if st := h.Status("test", l, 0, false, nil); st.ConsecutiveFailures != 3 || st.LastError != "invalid payload" {
+		t.Errorf("expected 3 failures, got %+v", st)
+	}
+
+	unchanged()
+	if st := h.Status("test", l, 0, false, nil); st.State != StateReady || st.ConsecutiveFailures != 0 {
+		t.Errorf("expected %s state with no failures, got %+v", StateReady, st)
+	}
+}
+
+func TestCombinedStatus(t *testing.T) {
+	l := NewLifecycle()
+	err := l.Start(context.Background(), func(ctx context.Context, booted chan<- error) {
+		booted <- nil
+		<-ctx.Done()
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer l.Stop()
+
+	h1, h2 := NewHealth(), NewHealth()
+	h1.Success()
+	h2.Success()
+	oldest := h1.lastSuccess
+	if st := CombinedStatus("test", l, 0, false, nil, h1, h2); st.State != StateReady || !st.LastSuccess.Equal(oldest) {
+		t.Errorf("expected %s state with the oldest last success %v, got %+v", StateReady, oldest, st)
+	}
+
+	h2.Failure(fmt.Errorf("invalid payload"))
+	h1.Success()
+	st := CombinedStatus("test", l, 0, false, nil, h1, h2)
+	if st.State != StateDegraded || st.ConsecutiveFailures != 1 || st.LastError != "invalid payload" {
+		t.Errorf("expected %s state caused by the failing source, got %+v", StateDegraded, st)
+	}
+}
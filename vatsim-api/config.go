@@ -1,6 +1,8 @@
 package vatsimapi
 
 import (
+	"time"
+
 	simwatchproviders "github.com/vatsimnerd/simwatch-providers"
 )
 
@@ -8,4 +10,20 @@ type Config struct {
 	URL  string                       `mapstructure:"url,omitempty"`
 	Poll simwatchproviders.PollConfig `mapstructure:"poll"`
 	Boot simwatchproviders.BootConfig `mapstructure:"boot,omitempty"`
+
+	Record *RecordConfig `mapstructure:"record,omitempty"`
+	Replay *ReplayConfig `mapstructure:"replay,omitempty"`
+
+	Freshness FreshnessConfig `mapstructure:"freshness,omitempty"`
+}
+
+// FreshnessConfig detects a frozen feed by its update timestamp
+type FreshnessConfig struct {
+	// StalePeriods is a number of poll periods with no newer payload
+	// after which the data is considered stale, zero disables the check
+	StalePeriods int `mapstructure:"stale_periods,omitempty"`
+	// PurgeAfter removes pilots and controllers which haven't been
+	// updated for longer than that as of the feed update timestamp,
+	// zero disables purging
+	PurgeAfter time.Duration `mapstructure:"purge_after,omitempty"`
 }
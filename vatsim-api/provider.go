@@ -1,13 +1,16 @@
 package vatsimapi
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/vatsimnerd/perfetch"
+	simwatchproviders "github.com/vatsimnerd/simwatch-providers"
 	"github.com/vatsimnerd/util/mapupdate"
 	"github.com/vatsimnerd/util/pubsub"
 )
@@ -17,11 +20,19 @@ type Provider struct {
 
 	cfg *Config
 
-	stop    chan bool
-	stopped bool
+	life   *simwatchproviders.Lifecycle
+	health *simwatchproviders.Health
+	cached *simwatchproviders.CacheTracker
 
 	controllers map[string]Controller
 	pilots      map[string]Pilot
+	general     *GeneralInfo
+
+	// feedTime is the update timestamp of the last applied payload
+	// and feedApplied is when it has been applied
+	feedTime    time.Time
+	feedApplied time.Time
+	feedStale   bool
 
 	dataLock sync.RWMutex
 }
@@ -31,43 +42,53 @@ const (
 
 	ObjectTypeController pubsub.ObjectType = iota + 1
 	ObjectTypePilot
+	ObjectTypeGeneral
+)
+
+const (
+	feedCacheName = "vatsim-data.json"
 )
 
 var (
 	log = logrus.WithField("module", "vatsim-api")
+
+	ErrNotFound = errors.New("not found")
+
+	errOutdatedPayload = errors.New("payload is not newer than the last applied one")
 )
 
 func New(cfg *Config) *Provider {
 	return &Provider{
 		Provider:    pubsub.NewProvider(),
 		cfg:         cfg,
-		stop:        make(chan bool),
-		stopped:     false,
+		life:        simwatchproviders.NewLifecycle(),
+		health:      simwatchproviders.NewHealth(),
+		cached:      simwatchproviders.NewCacheTracker(),
 		controllers: make(map[string]Controller),
 		pilots:      make(map[string]Pilot),
 	}
 }
 
-func (p *Provider) Start() error {
-	if p.stopped {
-		return fmt.Errorf("can't start once stopped provider")
-	}
-	go p.loop()
-	return nil
+// Start runs the provider loop until ctx is done or the provider is
+// stopped. It blocks until the initial data is loaded or ctx is done.
+// With replay configured the provider is booted once recorded payloads
+// are loaded.
+func (p *Provider) Start(ctx context.Context) error {
+	return p.life.Start(ctx, p.loop)
 }
 
+// Stop stops the provider and waits for its loop and poller to finish
 func (p *Provider) Stop() {
-	p.stop <- true
+	p.life.Stop()
 }
 
-func (p *Provider) loop() {
-	poller := perfetch.New(
-		p.cfg.Poll.Period,
-		perfetch.HTTPGetFetcher(p.cfg.URL, p.cfg.Poll.Timeout),
-	)
-	psub := poller.Subscribe(1024)
-	defer poller.Unsubscribe(psub)
+// Done returns a channel which is closed once the provider is stopped
+func (p *Provider) Done() <-chan struct{} {
+	return p.life.Done()
+}
 
+func (p *Provider) loop(ctx context.Context, booted chan<- error) {
+	defer p.Dispose()
 	p.SetInitialNotifier(func(sub pubsub.Subscription) {
 		// make notifier async to avoid reaching chan buffer limit
 		go func() {
@@ -79,84 +100,407 @@ func (p *Provider) loop() {
 			for _, pilot := range p.pilots {
 				sub.Send(pubsub.Update{UType: pubsub.UpdateTypeSet, OType: ObjectTypePilot, Obj: pilot})
 			}
+			if p.general != nil {
+				sub.Send(pubsub.Update{UType: pubsub.UpdateTypeSet, OType: ObjectTypeGeneral, Obj: p.general.Copy()})
+			}
 		}()
 	})
 
-	r := 0
-	for r < p.cfg.Boot.Retries {
-		err := poller.Start()
-		if err == nil {
-			break
+	var rec recorder
+	if p.cfg.Record != nil && p.cfg.Record.Path != "" {
+		var err error
+		rec, err = newRecorder(p.cfg.Record)
+		if err != nil {
+			log.WithError(err).Error("error creating payload recorder, recording is disabled")
+		} else {
+			defer func() {
+				if err := rec.close(); err != nil {
+					log.WithError(err).Error("error closing payload recorder")
+				}
+			}()
 		}
-		r++
-		log.WithError(err).WithField("retries_left", p.cfg.Boot.Retries-r).Error("error fetching boundaries (initial)")
-		if r == p.cfg.Boot.Retries {
-			log.Fatal("error fetching boundaries (initially), no retries left")
+	}
+
+	var source <-chan []byte
+	replaying := false
+	if p.cfg.Replay != nil && p.cfg.Replay.Path != "" {
+		rp, err := newReplayer(p.cfg.Replay)
+		if err != nil {
+			log.WithError(err).Error("error loading recorded payloads")
+			booted <- fmt.Errorf("error loading recorded payloads: %w", err)
+			return
+		}
+		source = rp.Updates()
+		replaying = true
+		rp.Start()
+		defer rp.Stop()
+	} else {
+		fetcher, err := simwatchproviders.NewFetcher(p.cfg.URL, p.cfg.Poll.Timeout)
+		if err != nil {
+			log.WithError(err).Error("error creating vatsim api fetcher")
+			booted <- fmt.Errorf("error creating vatsim api fetcher: %w", err)
+			return
 		}
-		time.Sleep(p.cfg.Boot.RetryCooldown)
+		fetcher = p.health.Track(fetcher)
+		// the first poll would fetch the payload which is fetched on boot
+		poller := perfetch.New(p.cfg.Poll.Period, simwatchproviders.SkipFirst(fetcher))
+		psub := poller.Subscribe(1024)
+		source = psub.Updates()
+
+		p.cached.SetCache(simwatchproviders.NewCache(p.cfg.Boot.CacheDir))
+		raw, stale, err := simwatchproviders.Boot(ctx, feedCacheName, fetcher, p.cfg.Boot, p.cached.Cache())
+		if err != nil {
+			log.WithError(err).Error("error fetching vatsim api data (initially)")
+			booted <- fmt.Errorf("error fetching vatsim api data: %w", err)
+			return
+		}
+		if !stale {
+			p.record(rec, raw)
+		}
+		err = p.process(raw, time.Now())
+		if err != nil {
+			p.health.Failure(err)
+			log.WithError(err).Error("error processing vatsim api data (initially)")
+			booted <- fmt.Errorf("error processing vatsim api data: %w", err)
+			return
+		}
+		p.cached.Parsed(feedCacheName, raw, stale)
+		if !stale {
+			p.health.Success()
+		}
+
+		if err := poller.Start(); err != nil {
+			log.WithError(err).Error("error starting vatsim api poller")
+			booted <- fmt.Errorf("error starting vatsim api poller: %w", err)
+			return
+		}
+		defer simwatchproviders.StopPoller(poller, psub)
+	}
+	booted <- nil
+
+	var freshnessTick <-chan time.Time
+	if p.cfg.Poll.Period > 0 && (p.cfg.Freshness.StalePeriods > 0 || p.cfg.Freshness.PurgeAfter > 0) {
+		t := time.NewTicker(p.cfg.Poll.Period)
+		defer t.Stop()
+		freshnessTick = t.C
 	}
-	defer poller.Stop()
 
 loop:
 	for {
 		select {
-		case raw := <-psub.Updates():
+		case raw, ok := <-source:
+			if !ok {
+				// replay is over, keep the last state until stopped
+				source = nil
+				continue loop
+			}
+			if raw == nil {
+				// the first poll is skipped, replay marks
+				// wrapping back to the first payload this way
+				if replaying {
+					p.rewindFeed()
+				}
+				continue loop
+			}
 			log.Debug("got update from vatsim api poller")
-			data := Data{}
-
-			err := json.Unmarshal(raw, &data)
+			p.record(rec, raw)
+			err := p.process(raw, time.Now())
+			if err == errOutdatedPayload {
+				// the feed is frozen or an old copy is served
+				log.Debug("ignoring outdated vatsim api data")
+				continue loop
+			}
 			if err != nil {
-				log.WithError(err).Error("error unmarshalling vatsim api data")
+				log.WithError(err).Error("error processing vatsim api data")
+				p.health.Failure(err)
 				continue loop
 			}
+			p.health.Success()
+			p.cached.Parsed(feedCacheName, raw, false)
 
-			controllers := make(map[string]Controller)
-			for _, vctrl := range data.Controllers {
-				ctrl, err := makeController(vctrl)
-				if err != nil {
-					log.WithError(err).WithField("callsign", vctrl.Callsign).Trace("skipping invalid controller")
-					continue
-				}
-				controllers[ctrl.Callsign] = ctrl
-			}
+		case now := <-freshnessTick:
+			p.checkFreshness(now)
 
-			for _, vctrl := range data.ATIS {
-				vctrl.Facility = FacilityATIS
-				ctrl, err := makeController(vctrl)
-				if err != nil {
-					log.WithError(err).WithField("callsign", vctrl.Callsign).Trace("skipping invalid controller")
-					continue
-				}
-				controllers[ctrl.Callsign] = ctrl
-			}
+		case <-ctx.Done():
+			break loop
+		}
+	}
+}
 
-			pilots := make(map[string]Pilot)
-			for _, vpilot := range data.Pilots {
-				pilot, err := makePilot(vpilot)
-				if err != nil {
-					log.WithError(err).WithField("callsign", vpilot.Callsign).Trace("skipping invalid pilot")
-					continue
-				}
-				pilots[pilot.Callsign] = pilot
-			}
+func (p *Provider) record(rec recorder, raw []byte) {
+	if rec == nil {
+		return
+	}
+	err := rec.record(Payload{Time: time.Now(), Data: raw})
+	if err != nil {
+		log.WithError(err).Error("error recording payload")
+	}
+}
 
-			ctrlSet, ctrlDel := mapupdate.Update[Controller, mapupdate.Comparable[Controller]](p.controllers, controllers, &p.dataLock)
-			for _, update := range pubsub.MakeUpdates(ctrlSet, ctrlDel, ObjectTypeController) {
-				p.Notify(update)
-			}
+// process parses a raw payload and notifies subscribers about changes.
+// Payloads which are not newer than the last applied one are ignored.
+func (p *Provider) process(raw []byte, now time.Time) error {
+	data := Data{}
 
-			pilotSet, pilotDel := mapupdate.Update[Pilot, mapupdate.Comparable[Pilot]](p.pilots, pilots, &p.dataLock)
-			for _, update := range pubsub.MakeUpdates(pilotSet, pilotDel, ObjectTypePilot) {
-				p.Notify(update)
-			}
-			p.Fin()
+	err := json.Unmarshal(raw, &data)
+	if err != nil {
+		return err
+	}
+
+	ts, err := data.General.Timestamp()
+	if err != nil {
+		log.WithError(err).Warn("can't parse feed update timestamp, accepting payload")
+	}
+	p.dataLock.Lock()
+	if !ts.IsZero() && !p.feedTime.IsZero() && !ts.After(p.feedTime) {
+		p.dataLock.Unlock()
+		return errOutdatedPayload
+	}
+	if !ts.IsZero() {
+		p.feedTime = ts
+	}
+	p.feedApplied = now
+	if p.feedStale {
+		log.WithField("update_timestamp", ts).Info("vatsim api data is fresh again")
+		p.feedStale = false
+	}
+	p.dataLock.Unlock()
 
-			p.SetDataReady(true)
+	// client ages are measured against the payload time so replayed
+	// and cached payloads are not purged as soon as they are applied
+	ref := ts
+	if ref.IsZero() {
+		ref = now
+	}
 
-		case <-p.stop:
-			break loop
+	rejectedControllers := 0
+	controllers := make(map[string]Controller)
+	for _, vctrl := range data.Controllers {
+		ctrl, err := makeController(vctrl)
+		if err != nil {
+			log.WithError(err).WithField("callsign", vctrl.Callsign).Trace("skipping invalid controller")
+			rejectedControllers++
+			continue
+		}
+		if p.isOutdated(ctrl.LastUpdated, ref) {
+			continue
+		}
+		controllers[ctrl.Callsign] = ctrl
+	}
+
+	for _, vctrl := range data.ATIS {
+		vctrl.Facility = FacilityATIS
+		ctrl, err := makeController(vctrl)
+		if err != nil {
+			log.WithError(err).WithField("callsign", vctrl.Callsign).Trace("skipping invalid controller")
+			rejectedControllers++
+			continue
 		}
+		if p.isOutdated(ctrl.LastUpdated, ref) {
+			continue
+		}
+		controllers[ctrl.Callsign] = ctrl
+	}
+
+	rejectedPilots := 0
+	pilots := make(map[string]Pilot)
+	for _, vpilot := range data.Pilots {
+		pilot, err := makePilot(vpilot)
+		if err != nil {
+			log.WithError(err).WithField("callsign", vpilot.Callsign).Trace("skipping invalid pilot")
+			rejectedPilots++
+			continue
+		}
+		if p.isOutdated(pilot.LastUpdated, ref) {
+			continue
+		}
+		pilots[pilot.Callsign] = pilot
+	}
+
+	// general info goes first so subscribers know
+	// the feed time of the following client updates
+	info := GeneralInfo{General: data.General, Counters: makeCounters(controllers, pilots)}
+	info.Counters.RejectedControllers = rejectedControllers
+	info.Counters.RejectedPilots = rejectedPilots
+	p.dataLock.Lock()
+	p.general = &info
+	p.dataLock.Unlock()
+	p.Notify(pubsub.Update{UType: pubsub.UpdateTypeSet, OType: ObjectTypeGeneral, Obj: info.Copy()})
+
+	ctrlSet, ctrlDel := mapupdate.Update[Controller, mapupdate.Comparable[Controller]](p.controllers, controllers, &p.dataLock)
+	for _, update := range pubsub.MakeUpdates(ctrlSet, ctrlDel, ObjectTypeController) {
+		p.Notify(update)
+	}
+
+	pilotSet, pilotDel := mapupdate.Update[Pilot, mapupdate.Comparable[Pilot]](p.pilots, pilots, &p.dataLock)
+	for _, update := range pubsub.MakeUpdates(pilotSet, pilotDel, ObjectTypePilot) {
+		p.Notify(update)
+	}
+	p.Fin()
+
+	p.SetDataReady(true)
+	return nil
+}
+
+func makeCounters(controllers map[string]Controller, pilots map[string]Pilot) Counters {
+	c := Counters{
+		Pilots:                len(pilots),
+		ControllersByFacility: make(map[Facility]int),
+	}
+	for _, ctrl := range controllers {
+		if ctrl.Facility == FacilityATIS {
+			c.ATIS++
+			continue
+		}
+		c.Controllers++
+		c.ControllersByFacility[ctrl.Facility]++
+	}
+	return c
+}
+
+// GetGeneralInfo returns the general block and counters
+// of the last applied payload
+func (p *Provider) GetGeneralInfo() (GeneralInfo, error) {
+	p.dataLock.RLock()
+	defer p.dataLock.RUnlock()
+	if p.general == nil {
+		return GeneralInfo{}, ErrNotFound
+	}
+	return p.general.Copy(), nil
+}
+
+// Timestamp returns the parsed update timestamp, a missing one is a zero time
+func (g General) Timestamp() (time.Time, error) {
+	return parseUpdateTimestamp(g.UpdateTimestamp)
+}
+
+// parseUpdateTimestamp parses the feed update timestamp which is
+// RFC3339 with fractional seconds. A missing timestamp is a zero time.
+func parseUpdateTimestamp(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	ts, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil && len(s) >= 19 {
+		ts, err = time.Parse(dateLayout, s[:19])
+	}
+	return ts, err
+}
+
+// rewindFeed forgets the last applied payload time so a looped replay
+// going back in time isn't rejected as outdated
+func (p *Provider) rewindFeed() {
+	p.dataLock.Lock()
+	defer p.dataLock.Unlock()
+	p.feedTime = time.Time{}
+}
+
+// isOutdated checks if a client hasn't been updated for longer than
+// the configured purge threshold as of the feed time ref
+func (p *Provider) isOutdated(lastUpdated time.Time, ref time.Time) bool {
+	purgeAfter := p.cfg.Freshness.PurgeAfter
+	return purgeAfter > 0 && ref.Sub(lastUpdated) > purgeAfter
+}
+
+// feedClockUnsafe estimates the feed time at now as the last applied
+// update timestamp advanced by the time passed since it's been applied
+func (p *Provider) feedClockUnsafe(now time.Time) time.Time {
+	if p.feedTime.IsZero() {
+		return now
+	}
+	return p.feedTime.Add(now.Sub(p.feedApplied))
+}
+
+// checkFreshness marks the data stale if no newer payload has been
+// applied for the configured number of poll periods and purges pilots
+// and controllers which haven't been updated for too long
+func (p *Provider) checkFreshness(now time.Time) {
+	p.dataLock.Lock()
+	if n := p.cfg.Freshness.StalePeriods; n > 0 && !p.feedStale {
+		if now.Sub(p.feedApplied) > time.Duration(n)*p.cfg.Poll.Period {
+			log.WithField("update_timestamp", p.feedTime).Warn("no newer vatsim api data received, data is stale")
+			p.feedStale = true
+		}
+	}
+
+	ref := p.feedClockUnsafe(now)
+	ctrlDel := make(map[string]Controller)
+	for callsign, ctrl := range p.controllers {
+		if p.isOutdated(ctrl.LastUpdated, ref) {
+			ctrlDel[callsign] = ctrl
+			delete(p.controllers, callsign)
+		}
+	}
+	pilotDel := make(map[string]Pilot)
+	for callsign, pilot := range p.pilots {
+		if p.isOutdated(pilot.LastUpdated, ref) {
+			pilotDel[callsign] = pilot
+			delete(p.pilots, callsign)
+		}
+	}
+
+	if len(ctrlDel) == 0 && len(pilotDel) == 0 {
+		p.dataLock.Unlock()
+		return
 	}
 
-	p.Dispose()
+	// counters are recomputed so they match the remaining clients,
+	// rejected clients are only known from the payload
+	var info *GeneralInfo
+	if p.general != nil {
+		counters := makeCounters(p.controllers, p.pilots)
+		counters.RejectedControllers = p.general.Counters.RejectedControllers
+		counters.RejectedPilots = p.general.Counters.RejectedPilots
+		p.general.Counters = counters
+		cp := p.general.Copy()
+		info = &cp
+	}
+	p.dataLock.Unlock()
+
+	log.WithFields(logrus.Fields{
+		"controllers": len(ctrlDel),
+		"pilots":      len(pilotDel),
+	}).Info("purging outdated clients")
+	if info != nil {
+		p.Notify(pubsub.Update{UType: pubsub.UpdateTypeSet, OType: ObjectTypeGeneral, Obj: *info})
+	}
+	for _, update := range pubsub.MakeUpdates(map[string]Controller{}, ctrlDel, ObjectTypeController) {
+		p.Notify(update)
+	}
+	for _, update := range pubsub.MakeUpdates(map[string]Pilot{}, pilotDel, ObjectTypePilot) {
+		p.Notify(update)
+	}
+	p.Fin()
+}
+
+// FeedTimestamp returns the update timestamp of the last applied payload
+func (p *Provider) FeedTimestamp() time.Time {
+	p.dataLock.RLock()
+	defer p.dataLock.RUnlock()
+	return p.feedTime
+}
+
+// Status reports the provider health
+func (p *Provider) Status() simwatchproviders.Status {
+	p.dataLock.RLock()
+	objects := map[string]int{
+		"controllers": len(p.controllers),
+		"pilots":      len(p.pilots),
+	}
+	p.dataLock.RUnlock()
+
+	var period time.Duration
+	if p.cfg != nil {
+		period = p.cfg.Poll.Period
+	}
+	return p.health.Status("vatsim-api", p.life, period, p.IsStale(), objects)
+}
+
+// IsStale returns true if the data has been loaded from the cache
+// and hasn't been refreshed from the API yet or if no newer data has
+// been received for the configured number of poll periods
+func (p *Provider) IsStale() bool {
+	p.dataLock.RLock()
+	defer p.dataLock.RUnlock()
+	return p.cached.IsStale() || p.feedStale
 }
@@ -0,0 +1,343 @@
+package vatsimapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	simwatchproviders "github.com/vatsimnerd/simwatch-providers"
+	"github.com/vatsimnerd/util/pubsub"
+)
+
+func makePayload(t *testing.T, ts time.Time, pilots ...VPilot) []byte {
+	data := Data{
+		General: General{UpdateTimestamp: ts.Format(time.RFC3339Nano)},
+		Pilots:  pilots,
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return raw
+}
+
+func makeVPilot(callsign string, lastUpdated time.Time) VPilot {
+	return VPilot{
+		Callsign:    callsign,
+		LogonTime:   lastUpdated.Format(dateLayout),
+		LastUpdated: lastUpdated.Format(dateLayout),
+	}
+}
+
+func TestOutdatedPayload(t *testing.T) {
+	p := New(&Config{})
+	now := time.Now().UTC().Truncate(time.Second)
+
+	if err := p.process(makePayload(t, now, makeVPilot("AFL123", now)), now); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	old := makePayload(t, now.Add(-time.Minute), makeVPilot("AFL123", now), makeVPilot("SBI456", now))
+	if err := p.process(old, now); err != errOutdatedPayload {
+		t.Errorf("expected %v, got %v", errOutdatedPayload, err)
+	}
+	if _, found := p.pilots["SBI456"]; found {
+		t.Error("outdated payload must not be applied")
+	}
+	if !p.FeedTimestamp().Equal(now) {
+		t.Errorf("expected feed timestamp %v, got %v", now, p.FeedTimestamp())
+	}
+}
+
+func TestRewindFeed(t *testing.T) {
+	p := New(&Config{})
+	base := time.Now().UTC().Truncate(time.Second)
+
+	testcases := []struct {
+		name   string
+		ts     time.Time
+		rewind bool
+		err    error
+	}{
+		{"first frame", base, false, nil},
+		{"next frame", base.Add(15 * time.Second), false, nil},
+		{"reordered frame", base.Add(5 * time.Second), false, errOutdatedPayload},
+		{"repeated frame", base.Add(15 * time.Second), false, errOutdatedPayload},
+		{"replay wrapped", base, true, nil},
+		{"next frame after wrap", base.Add(15 * time.Second), false, nil},
+	}
+
+	for _, tc := range testcases {
+		if tc.rewind {
+			p.rewindFeed()
+		}
+		err := p.process(makePayload(t, tc.ts, makeVPilot("AFL123", tc.ts)), base)
+		if err != tc.err {
+			t.Errorf("%s: expected error %v, got %v", tc.name, tc.err, err)
+		}
+	}
+}
+
+func TestStaleFeed(t *testing.T) {
+	p := New(&Config{
+		Poll:      simwatchproviders.PollConfig{Period: 15 * time.Second},
+		Freshness: FreshnessConfig{StalePeriods: 4, PurgeAfter: 5 * time.Minute},
+	})
+	sub := p.Subscribe(16)
+	now := time.Now().UTC().Truncate(time.Second)
+
+	payload := makePayload(t, now,
+		makeVPilot("AFL123", now),
+		makeVPilot("SBI456", now.Add(-4*time.Minute)),
+		makeVPilot("UAL789", now.Add(-10*time.Minute)),
+	)
+	if err := p.process(payload, now); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, found := p.pilots["UAL789"]; found {
+		t.Error("pilot not updated for longer than purge threshold is expected to be skipped")
+	}
+	for len(sub.Updates()) > 0 {
+		<-sub.Updates()
+	}
+
+	p.checkFreshness(now.Add(time.Minute))
+	if p.IsStale() {
+		t.Error("data is not expected to be stale within 4 poll periods")
+	}
+
+	p.checkFreshness(now.Add(2 * time.Minute))
+	if !p.IsStale() {
+		t.Error("data is expected to be stale after 4 poll periods")
+	}
+	if _, found := p.pilots["SBI456"]; found {
+		t.Error("outdated pilot is expected to be purged")
+	}
+	if _, found := p.pilots["AFL123"]; !found {
+		t.Error("up to date pilot is not expected to be purged")
+	}
+	upd := <-sub.Updates()
+	if info, ok := upd.Obj.(GeneralInfo); !ok || info.Counters.Pilots != 1 {
+		t.Errorf("expected general info update with recomputed counters, got %v", upd)
+	}
+	upd = <-sub.Updates()
+	if pilot, ok := upd.Obj.(Pilot); !ok || upd.UType != pubsub.UpdateTypeDelete || pilot.Callsign != "SBI456" {
+		t.Errorf("expected SBI456 delete update, got %v", upd)
+	}
+	if info, _ := p.GetGeneralInfo(); info.Counters.Pilots != 1 {
+		t.Errorf("expected 1 pilot counted after purge, got %d", info.Counters.Pilots)
+	}
+
+	if err := p.process(makePayload(t, now.Add(time.Minute), makeVPilot("AFL123", now)), now.Add(2*time.Minute)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p.IsStale() {
+		t.Error("data is expected to be fresh once a newer payload is applied")
+	}
+}
+
+func TestReplayedPayloadPurge(t *testing.T) {
+	p := New(&Config{
+		Poll:      simwatchproviders.PollConfig{Period: 15 * time.Second},
+		Freshness: FreshnessConfig{PurgeAfter: 5 * time.Minute},
+	})
+	now := time.Now().UTC().Truncate(time.Second)
+	// a payload recorded or cached a day ago
+	recorded := now.Add(-24 * time.Hour)
+
+	payload := makePayload(t, recorded,
+		makeVPilot("AFL123", recorded),
+		makeVPilot("UAL789", recorded.Add(-10*time.Minute)),
+	)
+	if err := p.process(payload, now); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, found := p.pilots["AFL123"]; !found {
+		t.Error("pilot up to date as of the payload time is expected to be applied")
+	}
+	if _, found := p.pilots["UAL789"]; found {
+		t.Error("pilot outdated as of the payload time is expected to be skipped")
+	}
+
+	p.checkFreshness(now.Add(time.Minute))
+	if _, found := p.pilots["AFL123"]; !found {
+		t.Error("pilot is not expected to be purged right after the payload is applied")
+	}
+
+	p.checkFreshness(now.Add(6 * time.Minute))
+	if _, found := p.pilots["AFL123"]; found {
+		t.Error("pilot is expected to be purged once no newer payload is applied for too long")
+	}
+}
+
+func TestGeneralInfo(t *testing.T) {
+	p := New(&Config{})
+	sub := p.Subscribe(16)
+	now := time.Now().UTC().Truncate(time.Second)
+
+	invalidPilot := makeVPilot("BAD1", now)
+	invalidPilot.LastUpdated = "not a valid timestamp"
+	ctrl := func(callsign string, facility int, freq string) VController {
+		return VController{
+			Callsign:    callsign,
+			Facility:    facility,
+			Frequency:   freq,
+			LogonTime:   now.Format(dateLayout),
+			LastUpdated: now.Format(dateLayout),
+		}
+	}
+	data := Data{
+		General: General{Version: 3, UpdateTimestamp: now.Format(time.RFC3339Nano), ConnectedClients: 6, UniqueUsers: 6},
+		Pilots:  []VPilot{makeVPilot("AFL123", now), makeVPilot("SBI456", now), invalidPilot},
+		Controllers: []VController{
+			ctrl("EGLL_TWR", FacilityTower, "118.500"),
+			ctrl("EGLL_GND", FacilityGround, "121.900"),
+			ctrl("EGTT_CTR", FacilityRadar, "999.000"),
+		},
+		ATIS: []VController{ctrl("EGLL_ATIS", 4, "128.075")},
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := p.process(raw, now); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	info, err := p.GetGeneralInfo()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.General.Version != 3 || info.General.UniqueUsers != 6 {
+		t.Errorf("unexpected general block %+v", info.General)
+	}
+	expected := Counters{
+		Pilots:                2,
+		Controllers:           2,
+		ControllersByFacility: map[Facility]int{FacilityTower: 1, FacilityGround: 1},
+		ATIS:                  1,
+		RejectedPilots:        1,
+		RejectedControllers:   1,
+	}
+	c := info.Counters
+	if c.Pilots != expected.Pilots || c.Controllers != expected.Controllers || c.ATIS != expected.ATIS ||
+		c.RejectedPilots != expected.RejectedPilots || c.RejectedControllers != expected.RejectedControllers ||
+		len(c.ControllersByFacility) != 2 || c.ControllersByFacility[FacilityTower] != 1 || c.ControllersByFacility[FacilityGround] != 1 {
+		t.Errorf("expected counters %+v, got %+v", expected, c)
+	}
+
+	published := false
+	for len(sub.Updates()) > 0 {
+		upd := <-sub.Updates()
+		if upd.OType == ObjectTypeGeneral {
+			published = true
+		}
+	}
+	if !published {
+		t.Error("general info is expected to be published")
+	}
+}
+
+func TestStartFailedClosesSubscriptions(t *testing.T) {
+	p := New(&Config{URL: "mem://missing-feed"})
+	sub := p.Subscribe(16)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := p.Start(ctx); err == nil {
+		t.Fatal("start is expected to fail with unreachable feed")
+	}
+	<-p.Done()
+
+	select {
+	case _, ok := <-sub.Updates():
+		if ok {
+			t.Error("no updates are expected from a failed provider")
+		}
+	case <-time.After(time.Second):
+		t.Error("subscription is expected to be closed once the provider has failed")
+	}
+}
+
+func TestFacilityRemap(t *testing.T) {
+	p := New(&Config{})
+	now := time.Now().UTC().Truncate(time.Second)
+
+	ctrl := func(callsign string, facility int) VController {
+		return VController{
+			Callsign:    callsign,
+			Facility:    facility,
+			Frequency:   "127.000",
+			LogonTime:   now.Format(dateLayout),
+			LastUpdated: now.Format(dateLayout),
+		}
+	}
+	data := Data{
+		General:     General{UpdateTimestamp: now.Format(time.RFC3339Nano)},
+		Controllers: []VController{ctrl("EDWW_FSS", 1), ctrl("EDDH_TWR", 4)},
+		// atis entries carry the facility of the position they belong to
+		ATIS: []VController{ctrl("EDDH_ATIS", 4), ctrl("EDDF_ATIS", 1)},
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := p.process(raw, now); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	testcases := []struct {
+		callsign string
+		facility Facility
+	}{
+		{"EDWW_FSS", FacilityFSS},
+		{"EDDH_TWR", FacilityTower},
+		{"EDDH_ATIS", FacilityATIS},
+		{"EDDF_ATIS", FacilityATIS},
+	}
+	for _, tc := range testcases {
+		c, found := p.controllers[tc.callsign]
+		if !found {
+			t.Errorf("%s: controller not found", tc.callsign)
+			continue
+		}
+		if c.Facility != tc.facility {
+			t.Errorf("%s: expected facility %d, got %d", tc.callsign, tc.facility, c.Facility)
+		}
+	}
+
+	info, _ := p.GetGeneralInfo()
+	if info.Counters.ATIS != 2 || info.Counters.ControllersByFacility[FacilityFSS] != 1 {
+		t.Errorf("expected 2 atis and 1 fss, got %+v", info.Counters)
+	}
+}
+
+func TestBootFetchesOnce(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		now := time.Now().UTC()
+		w.Write(makePayload(t, now, makeVPilot("AFL123", now)))
+	}))
+	defer srv.Close()
+
+	period := 200 * time.Millisecond
+	p := New(&Config{URL: srv.URL, Poll: simwatchproviders.PollConfig{Period: period, Timeout: time.Second}})
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer p.Stop()
+
+	// the poller doesn't repeat the boot request
+	time.Sleep(period / 2)
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("expected 1 request right after boot, got %d", n)
+	}
+	time.Sleep(2 * period)
+	if n := atomic.LoadInt32(&requests); n < 2 {
+		t.Errorf("expected the feed to be polled after boot, got %d requests", n)
+	}
+}
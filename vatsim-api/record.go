@@ -0,0 +1,333 @@
+package vatsimapi
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type (
+	// RecordConfig enables saving of every raw payload fetched from the API
+	RecordConfig struct {
+		// Path is a directory payloads are saved to as separate files,
+		// or a .tar.gz archive if the path has such an extension. An existing
+		// archive is never overwritten, a numbered archive is created next
+		// to it instead, i.e. payloads-1.tar.gz
+		Path string `mapstructure:"path"`
+	}
+
+	// ReplayConfig makes the provider read payloads previously saved with
+	// RecordConfig instead of polling the API
+	ReplayConfig struct {
+		Path string `mapstructure:"path"`
+		// Speed is a playback speed multiplier, zero value means real time
+		Speed float64 `mapstructure:"speed,omitempty"`
+		// NoDelay feeds payloads as fast as they are consumed
+		NoDelay bool `mapstructure:"no_delay,omitempty"`
+		// Loop restarts playback once all the payloads have been sent
+		Loop bool `mapstructure:"loop,omitempty"`
+	}
+
+	// Payload is a raw API response with the time it has been received at
+	Payload struct {
+		Time time.Time
+		Data []byte
+	}
+
+	recorder interface {
+		record(pl Payload) error
+		close() error
+	}
+
+	dirRecorder struct {
+		dir string
+	}
+
+	archiveRecorder struct {
+		f  *os.File
+		zw *gzip.Writer
+		tw *tar.Writer
+	}
+
+	replayer struct {
+		cfg      *ReplayConfig
+		payloads []Payload
+		ch       chan []byte
+		stop     chan bool
+	}
+)
+
+const (
+	payloadPrefix     = "vatsim-data-"
+	payloadSuffix     = ".json"
+	payloadTimeLayout = "20060102T150405.000000000Z"
+	archiveSuffix     = ".tar.gz"
+)
+
+func payloadName(ts time.Time) string {
+	return payloadPrefix + ts.UTC().Format(payloadTimeLayout) + payloadSuffix
+}
+
+func parsePayloadName(name string) (time.Time, error) {
+	name = filepath.Base(name)
+	if !strings.HasPrefix(name, payloadPrefix) || !strings.HasSuffix(name, payloadSuffix) {
+		return time.Time{}, fmt.Errorf("'%s' is not a recorded payload", name)
+	}
+	ts := strings.TrimSuffix(strings.TrimPrefix(name, payloadPrefix), payloadSuffix)
+	return time.Parse(payloadTimeLayout, ts)
+}
+
+func isArchive(path string) bool {
+	return strings.HasSuffix(path, archiveSuffix)
+}
+
+func newRecorder(cfg *RecordConfig) (recorder, error) {
+	if isArchive(cfg.Path) {
+		f, err := createArchive(cfg.Path)
+		if err != nil {
+			return nil, err
+		}
+		zw := gzip.NewWriter(f)
+		return &archiveRecorder{f: f, zw: zw, tw: tar.NewWriter(zw)}, nil
+	}
+	err := os.MkdirAll(cfg.Path, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &dirRecorder{dir: cfg.Path}, nil
+}
+
+// createArchive creates a new archive file rolling over to
+// a numbered file name if the archive already exists
+func createArchive(path string) (*os.File, error) {
+	base := strings.TrimSuffix(path, archiveSuffix)
+	name := path
+	for i := 1; ; i++ {
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			if name != path {
+				log.WithFields(logrus.Fields{
+					"path":     path,
+					"filename": name,
+				}).Warn("archive already exists, recording to a new one")
+			}
+			return f, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		name = fmt.Sprintf("%s-%d%s", base, i, archiveSuffix)
+	}
+}
+
+func (r *dirRecorder) record(pl Payload) error {
+	return os.WriteFile(filepath.Join(r.dir, payloadName(pl.Time)), pl.Data, 0644)
+}
+
+func (r *dirRecorder) close() error {
+	return nil
+}
+
+func (r *archiveRecorder) record(pl Payload) error {
+	hdr := &tar.Header{
+		Name:    payloadName(pl.Time),
+		Mode:    0644,
+		Size:    int64(len(pl.Data)),
+		ModTime: pl.Time,
+	}
+	err := r.tw.WriteHeader(hdr)
+	if err != nil {
+		return err
+	}
+	_, err = r.tw.Write(pl.Data)
+	if err != nil {
+		return err
+	}
+	// flush so the archive is readable up to the last payload
+	// even if the process is killed
+	err = r.tw.Flush()
+	if err != nil {
+		return err
+	}
+	return r.zw.Flush()
+}
+
+func (r *archiveRecorder) close() error {
+	err := r.tw.Close()
+	if err == nil {
+		err = r.zw.Close()
+	}
+	if cerr := r.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// LoadPayloads reads recorded payloads from a directory
+// or a .tar.gz archive sorted by time
+func LoadPayloads(path string) ([]Payload, error) {
+	var payloads []Payload
+	var err error
+	if isArchive(path) {
+		payloads, err = loadArchivePayloads(path)
+	} else {
+		payloads, err = loadDirPayloads(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(payloads, func(i, j int) bool { return payloads[i].Time.Before(payloads[j].Time) })
+	return payloads, nil
+}
+
+func loadDirPayloads(dir string) ([]Payload, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	payloads := make([]Payload, 0, len(entries))
+	for _, entry := range entries {
+		ts, err := parsePayloadName(entry.Name())
+		if entry.IsDir() || err != nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		payloads = append(payloads, Payload{Time: ts, Data: data})
+	}
+	return payloads, nil
+}
+
+func loadArchivePayloads(filename string) ([]Payload, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	payloads := make([]Payload, 0)
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// an archive written by a killed process has no proper end,
+			// everything read so far is still usable
+			if err == io.ErrUnexpectedEOF && len(payloads) > 0 {
+				log.WithError(err).Warn("archive is truncated")
+				break
+			}
+			return nil, err
+		}
+		ts, err := parsePayloadName(hdr.Name)
+		if err != nil {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		payloads = append(payloads, Payload{Time: ts, Data: data})
+	}
+	return payloads, nil
+}
+
+func newReplayer(cfg *ReplayConfig) (*replayer, error) {
+	payloads, err := LoadPayloads(cfg.Path)
+	if err != nil {
+		return nil, err
+	}
+	if len(payloads) == 0 {
+		return nil, fmt.Errorf("no recorded payloads found in '%s'", cfg.Path)
+	}
+	return &replayer{
+		cfg:      cfg,
+		payloads: payloads,
+		ch:       make(chan []byte),
+		stop:     make(chan bool),
+	}, nil
+}
+
+// Updates returns recorded payloads. When replay loops a nil payload
+// is sent before wrapping back to the first one.
+func (r *replayer) Updates() <-chan []byte {
+	return r.ch
+}
+
+func (r *replayer) Start() {
+	go r.loop()
+}
+
+// Stop stops playback and waits for the replay loop to finish
+func (r *replayer) Stop() {
+	close(r.stop)
+	for range r.ch {
+	}
+}
+
+func (r *replayer) delay(prev, cur time.Time) time.Duration {
+	if r.cfg.NoDelay {
+		return 0
+	}
+	speed := r.cfg.Speed
+	if speed <= 0 {
+		speed = 1
+	}
+	return time.Duration(float64(cur.Sub(prev)) / speed)
+}
+
+func (r *replayer) loop() {
+	defer close(r.ch)
+	log.WithFields(logrus.Fields{
+		"path":     r.cfg.Path,
+		"payloads": len(r.payloads),
+	}).Info("replaying recorded payloads")
+
+	for looped := false; ; looped = true {
+		if looped {
+			select {
+			case r.ch <- nil:
+			case <-r.stop:
+				return
+			}
+		}
+		for i, pl := range r.payloads {
+			if i > 0 {
+				if d := r.delay(r.payloads[i-1].Time, pl.Time); d > 0 {
+					select {
+					case <-time.After(d):
+					case <-r.stop:
+						return
+					}
+				}
+			}
+			select {
+			case r.ch <- pl.Data:
+			case <-r.stop:
+				return
+			}
+		}
+		if !r.cfg.Loop {
+			log.Info("replay finished")
+			return
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package vatsimapi
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecordReplay(t *testing.T) {
+	base := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	payloads := []Payload{
+		{Time: base, Data: []byte(`{"n":1}`)},
+		{Time: base.Add(15 * time.Second), Data: []byte(`{"n":2}`)},
+		{Time: base.Add(30 * time.Second), Data: []byte(`{"n":3}`)},
+	}
+
+	for _, path := range []string{
+		filepath.Join(t.TempDir(), "payloads"),
+		filepath.Join(t.TempDir(), "payloads.tar.gz"),
+	} {
+		rec, err := newRecorder(&RecordConfig{Path: path})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", path, err)
+		}
+		// recording order must not matter
+		for _, i := range []int{2, 0, 1} {
+			if err := rec.record(payloads[i]); err != nil {
+				t.Fatalf("%s: unexpected error: %v", path, err)
+			}
+		}
+		if err := rec.close(); err != nil {
+			t.Fatalf("%s: unexpected error: %v", path, err)
+		}
+
+		rp, err := newReplayer(&ReplayConfig{Path: path, NoDelay: true})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", path, err)
+		}
+		rp.Start()
+		i := 0
+		for data := range rp.Updates() {
+			if i >= len(payloads) {
+				t.Fatalf("%s: unexpected payload %s", path, data)
+			}
+			if string(data) != string(payloads[i].Data) {
+				t.Errorf("%s: expected payload %s, got %s", path, payloads[i].Data, data)
+			}
+			i++
+		}
+		if i != len(payloads) {
+			t.Errorf("%s: expected %d payloads, got %d", path, len(payloads), i)
+		}
+		rp.Stop()
+	}
+}
+
+func TestReplayLoop(t *testing.T) {
+	base := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	rp := &replayer{
+		cfg: &ReplayConfig{NoDelay: true, Loop: true},
+		payloads: []Payload{
+			{Time: base, Data: []byte(`{"n":1}`)},
+			{Time: base.Add(15 * time.Second), Data: []byte(`{"n":2}`)},
+		},
+		ch:   make(chan []byte),
+		stop: make(chan bool),
+	}
+	rp.Start()
+	defer rp.Stop()
+
+	// the replay wrap is marked with a nil payload
+	expected := []string{`{"n":1}`, `{"n":2}`, "", `{"n":1}`, `{"n":2}`, ""}
+	for i, exp := range expected {
+		data := <-rp.Updates()
+		if (exp == "") != (data == nil) || string(data) != exp {
+			t.Errorf("payload %d: expected '%s', got '%s'", i, exp, data)
+		}
+	}
+}
+
+func TestReplayDelay(t *testing.T) {
+	rp := &replayer{cfg: &ReplayConfig{Speed: 10}}
+	base := time.Now()
+	if d := rp.delay(base, base.Add(15*time.Second)); d != 1500*time.Millisecond {
+		t.Errorf("expected 1.5s delay, got %v", d)
+	}
+	rp.cfg.Speed = 0
+	if d := rp.delay(base, base.Add(15*time.Second)); d != 15*time.Second {
+		t.Errorf("expected real time delay, got %v", d)
+	}
+}
+
+func TestRecordArchiveRollover(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "payloads.tar.gz")
+	first := Payload{Time: time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC), Data: []byte(`{"n":1}`)}
+	second := Payload{Time: first.Time.Add(time.Hour), Data: []byte(`{"n":2}`)}
+
+	for _, pl := range []Payload{first, second} {
+		rec, err := newRecorder(&RecordConfig{Path: path})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := rec.record(pl); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := rec.close(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	testcases := []struct {
+		path    string
+		payload Payload
+	}{
+		{path, first},
+		{strings.TrimSuffix(path, archiveSuffix) + "-1" + archiveSuffix, second},
+	}
+	for _, tc := range testcases {
+		payloads, err := LoadPayloads(tc.path)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.path, err)
+		}
+		if len(payloads) != 1 || string(payloads[0].Data) != string(tc.payload.Data) {
+			t.Errorf("%s: expected payload %s, got %v", tc.path, tc.payload.Data, payloads)
+		}
+	}
+}
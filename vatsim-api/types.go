@@ -44,16 +44,38 @@ type (
 		LogonTime   time.Time   `json:"logon_time"`
 		LastUpdated time.Time   `json:"last_updated"`
 	}
+
+	// Counters are network totals derived from a feed payload
+	Counters struct {
+		Pilots                int              `json:"pilots"`
+		Controllers           int              `json:"controllers"`
+		ControllersByFacility map[Facility]int `json:"controllers_by_facility"`
+		ATIS                  int              `json:"atis"`
+		RejectedPilots        int              `json:"rejected_pilots"`
+		RejectedControllers   int              `json:"rejected_controllers"`
+	}
+
+	// GeneralInfo is the feed general block published with
+	// ObjectTypeGeneral along with the payload counters
+	GeneralInfo struct {
+		General  General  `json:"general"`
+		Counters Counters `json:"counters"`
+	}
 )
 
 const (
-	FacilityATIS     = 1
+	FacilityObserver = 0
+	FacilityFSS      = 1
 	FacilityDelivery = 2
 	FacilityGround   = 3
 	FacilityTower    = 4
 	FacilityApproach = 5
 	FacilityRadar    = 6
 
+	// FacilityATIS is not a VATSIM facility code, it's assigned to
+	// entries of the "atis" array and must not collide with the real ones
+	FacilityATIS = 100
+
 	dateLayout = "2006-01-02T15:04:05"
 )
 
@@ -99,6 +121,28 @@ func (p Pilot) NE(o Pilot) bool {
 	return *(p.FlightPlan) != *(o.FlightPlan)
 }
 
+func (p Pilot) Copy() Pilot {
+	cp := p
+	if p.FlightPlan != nil {
+		fp := *p.FlightPlan
+		cp.FlightPlan = &fp
+	}
+	return cp
+}
+
+func (c Counters) Copy() Counters {
+	cp := c
+	cp.ControllersByFacility = make(map[Facility]int, len(c.ControllersByFacility))
+	for f, n := range c.ControllersByFacility {
+		cp.ControllersByFacility[f] = n
+	}
+	return cp
+}
+
+func (g GeneralInfo) Copy() GeneralInfo {
+	return GeneralInfo{General: g.General, Counters: g.Counters.Copy()}
+}
+
 func parseFrequency(frequency string) (float64, error) {
 	freq, err := strconv.ParseFloat(frequency, 64)
 	if err != nil {
@@ -4,6 +4,7 @@ import (
 	"github.com/paulmach/orb"
 	"github.com/paulmach/orb/geojson"
 	"github.com/vatsimnerd/util/mapupdate"
+	"github.com/vatsimnerd/util/pubsub"
 )
 
 func (p *Provider) parseBoundaries(raw []byte) error {
@@ -49,12 +50,53 @@ func (p *Provider) parseBoundaries(raw []byte) error {
 		}
 	}
 
-	// todo proper update, i.e. update firs
-	_, _ = mapupdate.Update[Boundaries, mapupdate.Comparable[Boundaries]](p.bdrs, bdrs, &p.dataLock)
-
+	bdrsSet, bdrsDel := mapupdate.Update[Boundaries, mapupdate.Comparable[Boundaries]](p.bdrs, bdrs, &p.dataLock)
+	if len(bdrsSet) > 0 || len(bdrsDel) > 0 {
+		p.applyBoundaries()
+	}
 	return nil
 }
 
+// findBoundariesUnsafe looks up FIR boundaries by the FIR ID,
+// its prefix or its parent ID
+func (p *Provider) findBoundariesUnsafe(fir FIR) Boundaries {
+	if bnds, found := p.bdrs[fir.ID]; found {
+		return bnds
+	} else if bnds, found := p.bdrs[fir.Prefix]; found {
+		return bnds
+	} else if bnds, found := p.bdrs[fir.ParentID]; found {
+		return bnds
+	}
+	return Boundaries{}
+}
+
+// applyBoundaries re-attaches boundaries to already parsed FIRs as
+// the boundaries source may change while the data source doesn't
+func (p *Provider) applyBoundaries() {
+	p.dataLock.RLock()
+	if len(p.firs) == 0 {
+		// boundaries are attached once the data is parsed
+		p.dataLock.RUnlock()
+		return
+	}
+	firs := make(map[string]FIR, len(p.firs))
+	for id, fir := range p.firs {
+		fir.Boundaries = p.findBoundariesUnsafe(fir)
+		firs[id] = fir
+	}
+	p.dataLock.RUnlock()
+
+	firsSet, firsDel := mapupdate.Update[FIR, mapupdate.Comparable[FIR]](p.firs, firs, &p.dataLock)
+	if len(firsSet) == 0 && len(firsDel) == 0 {
+		return
+	}
+	log.WithField("firs", len(firsSet)).Info("boundaries changed, updating firs")
+	for _, update := range pubsub.MakeUpdates(firsSet, firsDel, ObjectTypeFIR) {
+		p.Notify(update)
+	}
+	p.Fin()
+}
+
 func readStringProp(feat *geojson.Feature, key string) string {
 	if value, found := feat.Properties[key]; found {
 		if str, ok := value.(string); ok {
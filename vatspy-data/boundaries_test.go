@@ -0,0 +1,61 @@
+package vatspydata
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	simwatchproviders "github.com/vatsimnerd/simwatch-providers"
+	"github.com/vatsimnerd/util/pubsub"
+)
+
+func boundariesPayload(west float64) []byte {
+	return []byte(fmt.Sprintf(`{"type":"FeatureCollection","features":[{"type":"Feature",`+
+		`"properties":{"id":"EGTT"},"geometry":{"type":"MultiPolygon","coordinates":`+
+		`[[[[%[1]g,50],[2,50],[2,55],[%[1]g,55],[%[1]g,50]]]]}}]}`, west))
+}
+
+func TestBoundariesOnlyChange(t *testing.T) {
+	simwatchproviders.SetMemSource("bdrs-test/data", []byte("[FIRs]\nEGTT|London|EGTT|\n"))
+	simwatchproviders.SetMemSource("bdrs-test/boundaries", boundariesPayload(-5))
+	defer simwatchproviders.DeleteMemSource("bdrs-test/data")
+	defer simwatchproviders.DeleteMemSource("bdrs-test/boundaries")
+
+	p := New(&Config{
+		DataURL:       "mem://bdrs-test/data",
+		BoundariesURL: "mem://bdrs-test/boundaries",
+		Poll:          simwatchproviders.PollConfig{Period: 10 * time.Millisecond},
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := p.Start(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer p.Stop()
+
+	sub := p.Subscribe(64)
+	// wait for the initial state to be sent
+	for upd := range sub.Updates() {
+		if upd.UType == pubsub.UpdateTypeFin {
+			break
+		}
+	}
+	// only the boundaries source changes, the data is skipped as unchanged
+	simwatchproviders.SetMemSource("bdrs-test/boundaries", boundariesPayload(-8))
+
+	for {
+		select {
+		case upd := <-sub.Updates():
+			if upd.UType != pubsub.UpdateTypeSet || upd.OType != ObjectTypeFIR {
+				continue
+			}
+			fir := upd.Obj.(FIR)
+			if fir.Boundaries.Min.Lng == -8 {
+				return
+			}
+		case <-ctx.Done():
+			t.Fatal("fir boundaries are expected to be updated")
+		}
+	}
+}
@@ -106,13 +106,7 @@ func (p *Provider) parseData(raw []byte) error {
 				ParentID: tokens[3],
 			}
 
-			if bnds, found := p.bdrs[fir.ID]; found {
-				fir.Boundaries = bnds
-			} else if bnds, found := p.bdrs[fir.Prefix]; found {
-				fir.Boundaries = bnds
-			} else if bnds, found := p.bdrs[fir.ParentID]; found {
-				fir.Boundaries = bnds
-			}
+			fir.Boundaries = p.findBoundariesUnsafe(fir)
 
 			firs[fir.ID] = fir
 
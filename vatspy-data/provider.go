@@ -1,11 +1,14 @@
 package vatspydata
 
 import (
+	"context"
+	"fmt"
 	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/vatsimnerd/perfetch"
+	simwatchproviders "github.com/vatsimnerd/simwatch-providers"
 	"github.com/vatsimnerd/util/pubsub"
 )
 
@@ -14,13 +17,16 @@ type Provider struct {
 
 	cfg *Config
 
-	stop      chan bool
-	stopped   bool
+	life      *simwatchproviders.Lifecycle
+	bhealth   *simwatchproviders.Health
+	dhealth   *simwatchproviders.Health
+	cached    *simwatchproviders.CacheTracker
 	bdrs      map[string]Boundaries
 	countries map[string]Country
 	firs      map[string]FIR
 	uirs      map[string]UIR
 	airports  map[string]AirportMeta
+	sources   []*simwatchproviders.Source
 
 	dataLock sync.RWMutex
 }
@@ -35,6 +41,11 @@ const (
 	ObjectTypeAirportMeta
 )
 
+const (
+	boundariesCacheName = "vatspy-boundaries.geojson"
+	dataCacheName       = "vatspy-data.dat"
+)
+
 var (
 	log = logrus.WithField("module", "vatspy-data")
 )
@@ -43,8 +54,10 @@ func New(cfg *Config) *Provider {
 	return &Provider{
 		Provider:  pubsub.NewProvider(),
 		cfg:       cfg,
-		stop:      make(chan bool),
-		stopped:   false,
+		life:      simwatchproviders.NewLifecycle(),
+		bhealth:   simwatchproviders.NewHealth(),
+		dhealth:   simwatchproviders.NewHealth(),
+		cached:    simwatchproviders.NewCacheTracker(),
 		bdrs:      make(map[string]Boundaries),
 		countries: make(map[string]Country),
 		firs:      make(map[string]FIR),
@@ -53,19 +66,70 @@ func New(cfg *Config) *Provider {
 	}
 }
 
-func (p *Provider) Start() {
-	if p.stopped {
-		log.Fatal("can't start once stopped provider")
-	}
-	go p.loop()
+// Start runs the provider loop until ctx is done or the provider is
+// stopped. It blocks until the initial data is loaded or ctx is done.
+func (p *Provider) Start(ctx context.Context) error {
+	return p.life.Start(ctx, p.loop)
 }
 
+// Stop stops the provider and waits for its loop and pollers to finish
 func (p *Provider) Stop() {
-	p.stop <- true
+	p.life.Stop()
+}
+
+// Done returns a channel which is closed once the provider is stopped
+func (p *Provider) Done() <-chan struct{} {
+	return p.life.Done()
+}
+
+// boot creates the sources and loads the initial data
+func (p *Provider) boot(ctx context.Context) error {
+	bsource, err := simwatchproviders.NewSource(p.cfg.BoundariesURL, p.cfg.Poll.Timeout)
+	if err != nil {
+		return fmt.Errorf("error creating boundaries source: %w", err)
+	}
+	dsource, err := simwatchproviders.NewSource(p.cfg.DataURL, p.cfg.Poll.Timeout)
+	if err != nil {
+		return fmt.Errorf("error creating data source: %w", err)
+	}
+	p.dataLock.Lock()
+	p.sources = []*simwatchproviders.Source{bsource, dsource}
+	p.dataLock.Unlock()
+	p.cached.SetCache(simwatchproviders.NewCache(p.cfg.Boot.CacheDir))
+
+	buf, stale, err := simwatchproviders.Boot(ctx, boundariesCacheName, p.bhealth.Track(bsource.Fetch), p.cfg.Boot, p.cached.Cache())
+	if err != nil {
+		return fmt.Errorf("error fetching boundaries: %w", err)
+	}
+	err = p.parseBoundaries(buf)
+	if err != nil {
+		p.bhealth.Failure(err)
+		return fmt.Errorf("error parsing boundaries: %w", err)
+	}
+	p.cached.Parsed(boundariesCacheName, buf, stale)
+	if !stale {
+		p.bhealth.Success()
+	}
+
+	buf, stale, err = simwatchproviders.Boot(ctx, dataCacheName, p.dhealth.Track(dsource.Fetch), p.cfg.Boot, p.cached.Cache())
+	if err != nil {
+		return fmt.Errorf("error fetching data: %w", err)
+	}
+	err = p.parseData(buf)
+	if err != nil {
+		p.dhealth.Failure(err)
+		return fmt.Errorf("error parsing data: %w", err)
+	}
+	p.cached.Parsed(dataCacheName, buf, stale)
+	if !stale {
+		p.dhealth.Success()
+	}
+	return nil
 }
 
-func (p *Provider) loop() {
+func (p *Provider) loop(ctx context.Context, booted chan<- error) {
 	log.Info("entering vatspy data provider loop()")
+	defer p.Dispose()
 
 	p.SetInitialNotifier(func(sub pubsub.Subscription) {
 		go func() {
@@ -88,75 +152,109 @@ func (p *Provider) loop() {
 		}()
 	})
 
-	bpoller := perfetch.New(
-		p.cfg.Poll.Period,
-		perfetch.HTTPGetFetcher(p.cfg.BoundariesURL, p.cfg.Poll.Timeout),
-	)
-	dpoller := perfetch.New(
-		p.cfg.Poll.Period,
-		perfetch.HTTPGetFetcher(p.cfg.DataURL, p.cfg.Poll.Timeout),
-	)
+	err := p.boot(ctx)
+	if err != nil {
+		log.WithError(err).Error("error booting vatspy data provider")
+		booted <- err
+		return
+	}
+
+	bpoller := perfetch.New(p.cfg.Poll.Period, simwatchproviders.SkipFirst(p.bhealth.Track(p.sources[0].Fetcher())))
+	dpoller := perfetch.New(p.cfg.Poll.Period, simwatchproviders.SkipFirst(p.dhealth.Track(p.sources[1].Fetcher())))
 
 	bsub := bpoller.Subscribe(10)
 	dsub := dpoller.Subscribe(10)
 
-	r := 0
-	for r < p.cfg.Boot.Retries {
-		err := bpoller.Start()
-		if err == nil {
-			break
-		}
-		r++
-		log.WithError(err).WithField("retries_left", p.cfg.Boot.Retries-r).Error("error fetching boundaries (initial)")
-		if r == p.cfg.Boot.Retries {
-			log.Fatal("error fetching boundaries (initially), no retries left")
-		}
-		time.Sleep(p.cfg.Boot.RetryCooldown)
-	}
-	defer bpoller.Stop()
-
-	buf := <-bsub.Updates()
-	err := p.parseBoundaries(buf)
-	if err != nil {
-		log.WithError(err).Fatal("error parsing boundaries, giving up")
+	// initial payloads are already fetched on boot so
+	// the first polls are skipped
+	if err := bpoller.Start(); err != nil {
+		log.WithError(err).Error("error starting boundaries poller")
+		booted <- fmt.Errorf("error starting boundaries poller: %w", err)
+		return
 	}
-
-	r = 0
-	for r < p.cfg.Boot.Retries {
-		err := dpoller.Start()
-		if err == nil {
-			break
-		}
-		r++
-		log.WithError(err).WithField("retries_left", p.cfg.Boot.Retries-r).Error("error fetching data (initial)")
-		if r == p.cfg.Boot.Retries {
-			log.Fatal("error fetching data (initially), no retries left")
-		}
-		time.Sleep(p.cfg.Boot.RetryCooldown)
+	defer simwatchproviders.StopPoller(bpoller, bsub)
+	if err := dpoller.Start(); err != nil {
+		log.WithError(err).Error("error starting data poller")
+		booted <- fmt.Errorf("error starting data poller: %w", err)
+		return
 	}
+	defer simwatchproviders.StopPoller(dpoller, dsub)
 
 	p.SetDataReady(true)
-	defer dpoller.Stop()
+	booted <- nil
 
 loop:
 	for {
 		select {
 		case buf := <-dsub.Updates():
+			if buf == nil {
+				// not modified
+				continue
+			}
 			err := p.parseData(buf)
 			if err != nil {
 				log.WithError(err).Error("error parsing data")
+				p.dhealth.Failure(err)
+				// retry the payload on the next poll
+				p.sources[1].Invalidate()
+			} else {
+				p.cached.Parsed(dataCacheName, buf, false)
+				p.dhealth.Success()
 			}
 		case buf := <-bsub.Updates():
+			if buf == nil {
+				// not modified
+				continue
+			}
 			err := p.parseBoundaries(buf)
 			if err != nil {
 				log.WithError(err).Error("error parsing boundaries")
+				p.bhealth.Failure(err)
+				// retry the payload on the next poll
+				p.sources[0].Invalidate()
+			} else {
+				p.cached.Parsed(boundariesCacheName, buf, false)
+				p.bhealth.Success()
 			}
-		case <-p.stop:
-			p.stopped = true
+		case <-ctx.Done():
 			log.Info("stop signal received")
 			break loop
 		}
 	}
+}
+
+// Status reports the provider health
+func (p *Provider) Status() simwatchproviders.Status {
+	p.dataLock.RLock()
+	objects := map[string]int{
+		"countries": len(p.countries),
+		"firs":      len(p.firs),
+		"uirs":      len(p.uirs),
+		"airports":  len(p.airports),
+	}
+	p.dataLock.RUnlock()
+
+	var period time.Duration
+	if p.cfg != nil {
+		period = p.cfg.Poll.Period
+	}
+	return simwatchproviders.CombinedStatus("vatspy-data", p.life, period, p.IsStale(), objects, p.bhealth, p.dhealth)
+}
+
+// SourceStatus reports when boundaries and data sources
+// have been checked and changed
+func (p *Provider) SourceStatus() []simwatchproviders.SourceStatus {
+	p.dataLock.RLock()
+	defer p.dataLock.RUnlock()
+	status := make([]simwatchproviders.SourceStatus, 0, len(p.sources))
+	for _, src := range p.sources {
+		status = append(status, src.Status())
+	}
+	return status
+}
 
-	p.Dispose()
+// IsStale returns true if any data has been loaded from the cache
+// and hasn't been refreshed from the source yet
+func (p *Provider) IsStale() bool {
+	return p.cached.IsStale()
 }
@@ -0,0 +1,47 @@
+package vatspydata
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	simwatchproviders "github.com/vatsimnerd/simwatch-providers"
+)
+
+func TestUnparseablePayloadKeepsDegraded(t *testing.T) {
+	simwatchproviders.SetMemSource("health-test/data", []byte("[FIRs]\nEGTT|London|EGTT|\n"))
+	simwatchproviders.SetMemSource("health-test/boundaries", boundariesPayload(-5))
+	defer simwatchproviders.DeleteMemSource("health-test/data")
+	defer simwatchproviders.DeleteMemSource("health-test/boundaries")
+
+	period := 10 * time.Millisecond
+	p := New(&Config{
+		DataURL:       "mem://health-test/data",
+		BoundariesURL: "mem://health-test/boundaries",
+		Poll:          simwatchproviders.PollConfig{Period: period},
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := p.Start(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer p.Stop()
+
+	simwatchproviders.SetMemSource("health-test/boundaries", []byte("not a geojson"))
+
+	// the broken payload must not be reported healthy by the following
+	// polls returning the same content
+	deadline := time.After(20 * period)
+	for failures := 0; failures < 3; {
+		select {
+		case <-deadline:
+			t.Fatalf("expected the provider to keep failing, got %+v", p.Status())
+		case <-time.After(period):
+			st := p.Status()
+			if st.ConsecutiveFailures > 0 && st.State != simwatchproviders.StateDegraded {
+				t.Fatalf("expected %s state, got %+v", simwatchproviders.StateDegraded, st)
+			}
+			failures = st.ConsecutiveFailures
+		}
+	}
+}
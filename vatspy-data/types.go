@@ -110,3 +110,30 @@ func (u UIR) NE(o UIR) bool {
 	}
 	return false
 }
+
+func (b Boundaries) Copy() Boundaries {
+	cp := b
+	if b.Points != nil {
+		cp.Points = make([][]Point, len(b.Points))
+		for i, poly := range b.Points {
+			cp.Points[i] = make([]Point, len(poly))
+			copy(cp.Points[i], poly)
+		}
+	}
+	return cp
+}
+
+func (f FIR) Copy() FIR {
+	cp := f
+	cp.Boundaries = f.Boundaries.Copy()
+	return cp
+}
+
+func (u UIR) Copy() UIR {
+	cp := u
+	if u.FIRIDs != nil {
+		cp.FIRIDs = make([]string, len(u.FIRIDs))
+		copy(cp.FIRIDs, u.FIRIDs)
+	}
+	return cp
+}